@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// RegisterFieldAliases maps legacy top-level field names to their current
+// names for a collection, e.g. {"Phone": "Contact"}. Records read from the
+// collection are decoded as if they had been written with the new names.
+// Nested fields are not renamed.
+func (d *Driver) RegisterFieldAliases(collection string, aliases map[string]string) {
+	collection, _, _ = d.transformKeys(collection, "")
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	m := make(map[string]string, len(aliases))
+	for legacy, current := range aliases {
+		m[legacy] = current
+	}
+	d.aliases[collection] = m
+}
+
+// LegacyKeys scans a collection and returns, for every registered legacy
+// field name, the number of records that still contain it. Once every count
+// is zero the aliases can be retired.
+func (d *Driver) LegacyKeys(collection string) (map[string]int, error) {
+	collection, _, err := d.transformKeys(collection, "")
+	if err != nil {
+		return nil, err
+	}
+
+	aliases := d.fieldAliases(collection)
+	report := make(map[string]int, len(aliases))
+	for legacy := range aliases {
+		report[legacy] = 0
+	}
+
+	err = d.forEachFile(collection, func(resource string, b []byte) error {
+		var doc map[string]json.RawMessage
+		if err := json.Unmarshal(b, &doc); err != nil {
+			return nil
+		}
+
+		for legacy := range aliases {
+			if _, ok := doc[legacy]; ok {
+				report[legacy]++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func (d *Driver) fieldAliases(collection string) map[string]string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.aliases[collection]
+}
+
+// applyAliases renames legacy fields in b and, when MigrateOnRead is set,
+// writes the renamed record back to disk.
+func (d *Driver) applyAliases(collection, resource string, b []byte) ([]byte, error) {
+	aliases := d.fieldAliases(collection)
+	if len(aliases) == 0 {
+		return b, nil
+	}
+
+	renamed, changed := renameFields(b, aliases)
+	if !changed {
+		return b, nil
+	}
+
+	if d.migrateOnRead && d.frozen(collection, true) == nil && !d.readOnly(collection) && !d.immutable(collection) {
+		if err := d.migrate(collection, resource, aliases); err != nil {
+			d.logger.Warn("Unable to migrate %s/%s: %v", collection, resource, err)
+		}
+	}
+	return renamed, nil
+}
+
+// migrate re-reads a record under the collection lock, so a concurrent Write
+// is never overwritten with stale data, and rewrites it with current names.
+func (d *Driver) migrate(collection, resource string, aliases map[string]string) error {
+	mutex, err := d.lockMutable(collection)
+	if err != nil {
+		return err
+	}
+	defer mutex.Unlock()
+
+	b, err := d.readFile(d.recordPath(collection, resource))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	renamed, changed := renameFields(b, aliases)
+	if !changed {
+		return nil
+	}
+	return d.write(collection, resource, renamed)
+}
+
+// renameFields returns b re-encoded with legacy keys replaced. A legacy key
+// is dropped without copying if the document already has the current key.
+func renameFields(b []byte, aliases map[string]string) ([]byte, bool) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return b, false
+	}
+
+	changed := false
+	for legacy, current := range aliases {
+		value, ok := doc[legacy]
+		if !ok {
+			continue
+		}
+		if _, exists := doc[current]; !exists {
+			doc[current] = value
+		}
+		delete(doc, legacy)
+		changed = true
+	}
+
+	if !changed {
+		return b, false
+	}
+
+	out, err := json.MarshalIndent(doc, "", "\t")
+	if err != nil {
+		return b, false
+	}
+	return append(out, byte('\n')), true
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// maxSamples bounds how many offending resources a CheckResult keeps.
+const maxSamples = 10
+
+// Check is an advisory data quality rule evaluated once per record. Checks
+// may keep state between records; use a fresh instance per Analyze call.
+type Check interface {
+	Name() string
+	Offends(resource string, doc interface{}) bool
+}
+
+type CheckResult struct {
+	Name    string
+	Count   int
+	Samples []string
+}
+
+type AnalysisReport struct {
+	Collection string
+	Records    int
+	Malformed  CheckResult
+	Results    []CheckResult
+
+	// DecodeErrors describes the first malformed records in detail.
+	DecodeErrors []*DecodeError
+}
+
+// Failing returns the results whose share of offending records is above
+// maxRatio (0 to 1), along with malformed records if there are any.
+func (r AnalysisReport) Failing(maxRatio float64) []CheckResult {
+	var failing []CheckResult
+	if r.Malformed.Count > 0 {
+		failing = append(failing, r.Malformed)
+	}
+	for _, result := range r.Results {
+		if r.Records > 0 && float64(result.Count)/float64(r.Records) > maxRatio {
+			failing = append(failing, result)
+		}
+	}
+	return failing
+}
+
+func (r AnalysisReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %d records\n", r.Collection, r.Records)
+	if r.Malformed.Count > 0 {
+		r.Malformed.writeTo(&b)
+	}
+	for _, result := range r.Results {
+		result.writeTo(&b)
+	}
+	return b.String()
+}
+
+func (r CheckResult) writeTo(b *strings.Builder) {
+	fmt.Fprintf(b, "  %-40s %d", r.Name, r.Count)
+	if len(r.Samples) > 0 {
+		fmt.Fprintf(b, "  (e.g. %s)", strings.Join(r.Samples, ", "))
+	}
+	b.WriteString("\n")
+}
+
+// Analyze runs checks over every record of a collection in a single pass.
+func (d *Driver) Analyze(collection string, checks ...Check) (AnalysisReport, error) {
+	collection, _, err := d.transformKeys(collection, "")
+	if err != nil {
+		return AnalysisReport{}, err
+	}
+
+	report := AnalysisReport{
+		Collection: collection,
+		Malformed:  CheckResult{Name: "malformed"},
+		Results:    make([]CheckResult, len(checks)),
+	}
+	for i, check := range checks {
+		report.Results[i].Name = check.Name()
+	}
+
+	err = d.forEachRecord(collection, func(resource string, b []byte) error {
+		report.Records++
+
+		doc, err := decodeDocument(b)
+		if err != nil {
+			report.Malformed.add(resource)
+			if len(report.DecodeErrors) < maxSamples {
+				report.DecodeErrors = append(report.DecodeErrors, d.decodeError(collection, resource, b, err).(*DecodeError))
+			}
+			return nil
+		}
+
+		for i, check := range checks {
+			if check.Offends(resource, doc) {
+				report.Results[i].add(resource)
+			}
+		}
+		return nil
+	})
+	return report, err
+}
+
+func (r *CheckResult) add(resource string) {
+	r.Count++
+	if len(r.Samples) < maxSamples {
+		r.Samples = append(r.Samples, resource)
+	}
+}
+
+type emptyFieldCheck struct{ field string }
+
+// EmptyFieldCheck flags records where field is missing, null, "", an empty
+// array or an empty object. Use AnalysisReport.Failing to apply a ratio.
+func EmptyFieldCheck(field string) Check {
+	return emptyFieldCheck{field}
+}
+
+func (c emptyFieldCheck) Name() string { return "empty " + c.field }
+
+func (c emptyFieldCheck) Offends(resource string, doc interface{}) bool {
+	value, ok := lookupField(doc, c.field)
+	if !ok {
+		return true
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+type numericStringCheck struct{ field string }
+
+// NumericStringCheck flags records where field holds a number encoded as a
+// JSON string, e.g. "42" instead of 42.
+func NumericStringCheck(field string) Check {
+	return numericStringCheck{field}
+}
+
+func (c numericStringCheck) Name() string { return "numeric string " + c.field }
+
+func (c numericStringCheck) Offends(resource string, doc interface{}) bool {
+	value, _ := lookupField(doc, c.field)
+	s, ok := value.(string)
+	if !ok {
+		return false
+	}
+	_, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	return err == nil
+}
+
+type casingCheck struct {
+	field string
+	seen  map[string]string
+}
+
+// CasingCheck flags records whose string value for field differs only in
+// case from a value seen earlier in the scan, e.g. "CA" after "ca".
+func CasingCheck(field string) Check {
+	return &casingCheck{field: field, seen: make(map[string]string)}
+}
+
+func (c *casingCheck) Name() string { return "inconsistent casing " + c.field }
+
+func (c *casingCheck) Offends(resource string, doc interface{}) bool {
+	value, _ := lookupField(doc, c.field)
+	s, ok := value.(string)
+	if !ok {
+		return false
+	}
+
+	folded := strings.ToLower(s)
+	first, ok := c.seen[folded]
+	if !ok {
+		c.seen[folded] = s
+		return false
+	}
+	return first != s
+}
+
+type referenceCheck struct {
+	d      *Driver
+	field  string
+	target string
+	exists map[string]bool
+}
+
+// ReferenceCheck flags records whose field names a resource that does not
+// exist in the target collection.
+func (d *Driver) ReferenceCheck(field, target string) Check {
+	return &referenceCheck{d: d, field: field, target: target, exists: make(map[string]bool)}
+}
+
+func (c *referenceCheck) Name() string {
+	return "orphaned " + c.field + " -> " + c.target
+}
+
+func (c *referenceCheck) Offends(resource string, doc interface{}) bool {
+	value, ok := lookupField(doc, c.field)
+	if !ok || value == nil {
+		return false
+	}
+
+	key := fmt.Sprint(value)
+	exists, ok := c.exists[key]
+	if !ok {
+		if target, resource, err := c.d.transformKeys(c.target, key); err == nil {
+			_, err = os.Stat(c.d.recordPath(target, resource))
+			exists = err == nil
+		}
+		c.exists[key] = exists
+	}
+	return !exists
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Append-only collections store records under a directory per UTC day:
+//
+//	events/2026-10-14/01JA2X3K4M5N6P7Q8R9S0T1V2W.json
+//
+// Keys are ULID-style: 48 bits of millisecond timestamp followed by 80 bits
+// that are random for each new millisecond and incremented within one, so
+// keys sort by time and are unique within this driver.
+const (
+	appendDayLayout = "2006-01-02"
+	appendKeyLength = 26
+	crockford       = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+)
+
+// Append writes v to a time-ordered collection under a newly generated key
+// and returns that key.
+func (d *Driver) Append(collection string, v interface{}) (string, error) {
+	collection, _, err := d.transformKeys(collection, "")
+	if err != nil {
+		return "", err
+	}
+
+	if collection == "" {
+		return "", ErrMissingCollection
+	}
+
+	key, err := d.nextAppendKey(time.Now())
+	if err != nil {
+		return "", err
+	}
+	t, _ := appendKeyTime(key)
+	resource := filepath.Join(t.UTC().Format(appendDayLayout), key)
+
+	mutex, err := d.lockWritable(collection)
+	if err != nil {
+		return "", err
+	}
+	defer mutex.Unlock()
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if err := d.marshalValue(buf, collection, v); err != nil {
+		return "", err
+	}
+
+	b, err := d.prepareGenerated(collection, resource, buf.Bytes())
+	if err != nil {
+		return "", err
+	}
+
+	if err := d.writeRecord(collection, resource, b); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// ScanRange returns the records of an append-only collection whose keys fall
+// in [from, to), oldest first. Only day directories overlapping the range
+// are read.
+func (d *Driver) ScanRange(collection string, from, to time.Time) ([]string, error) {
+	collection, _, err := d.transformKeys(collection, "")
+	if err != nil {
+		return nil, err
+	}
+
+	days, err := d.appendDays(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.checkFrozen(collection); err != nil {
+		return nil, err
+	}
+
+	fromDay := from.UTC().Format(appendDayLayout)
+	toDay := to.UTC().Format(appendDayLayout)
+
+	var records []string
+	for _, day := range days {
+		if day < fromDay || day > toDay {
+			continue
+		}
+
+		dir := filepath.Join(d.dir, collection, day)
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			key, ok := d.recordName(dir, file)
+			if !ok {
+				continue
+			}
+
+			t, ok := appendKeyTime(key)
+			if !ok || t.Before(from) || !t.Before(to) {
+				continue
+			}
+
+			b, err := d.readFile(d.recordPath(collection, filepath.Join(day, key)))
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, string(b))
+		}
+	}
+	return records, nil
+}
+
+// PurgeBefore deletes every record of an append-only collection older than
+// cutoff. Days entirely before the cutoff are removed as whole directories.
+func (d *Driver) PurgeBefore(collection string, cutoff time.Time) error {
+	collection, _, err := d.transformKeys(collection, "")
+	if err != nil {
+		return err
+	}
+
+	mutex, err := d.lockMutable(collection)
+	if err != nil {
+		return err
+	}
+	defer mutex.Unlock()
+
+	return d.purgeBefore(collection, cutoff)
+}
+
+// purgeBefore is PurgeBefore with the collection mutex held.
+func (d *Driver) purgeBefore(collection string, cutoff time.Time) error {
+	days, err := d.appendDays(collection)
+	if err != nil {
+		return err
+	}
+
+	cutoffDay := cutoff.UTC().Format(appendDayLayout)
+	for _, day := range days {
+		dir := filepath.Join(d.dir, collection, day)
+
+		if day < cutoffDay {
+			removed := d.readForRemoval(collection, day)
+			if err := os.RemoveAll(dir); err != nil {
+				return err
+			}
+			if err := d.removeAttachments(collection, day); err != nil {
+				return err
+			}
+			d.recordRemovals(collection, removed)
+			continue
+		}
+
+		if day > cutoffDay {
+			break
+		}
+
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+
+		for _, file := range files {
+			key, ok := d.recordName(dir, file)
+			if !ok {
+				continue
+			}
+
+			if t, ok := appendKeyTime(key); ok && t.Before(cutoff) {
+				resource := filepath.Join(day, key)
+				before, tracked := d.previousVersion(collection, resource)
+				if err := os.RemoveAll(filepath.Join(dir, file.Name())); err != nil {
+					return err
+				}
+				if err := d.removeAttachments(collection, resource); err != nil {
+					return err
+				}
+				d.recordChange(collection, resource, tracked, before, nil)
+			}
+		}
+	}
+
+	d.invalidateModIndex(collection)
+	d.updateIndexes(collection, "", nil)
+	d.scheduleSync(filepath.Join(d.dir, collection))
+	return nil
+}
+
+// appendDays lists the day directories of a collection in ascending order.
+func (d *Driver) appendDays(collection string) ([]string, error) {
+	if collection == "" {
+		return nil, ErrMissingCollection
+	}
+
+	files, err := ioutil.ReadDir(filepath.Join(d.dir, collection))
+	if err != nil {
+		return nil, err
+	}
+
+	var days []string
+	for _, file := range files {
+		if _, err := time.Parse(appendDayLayout, file.Name()); file.IsDir() && err == nil {
+			days = append(days, file.Name())
+		}
+	}
+	return days, nil
+}
+
+func (d *Driver) nextAppendKey(now time.Time) (string, error) {
+	d.appendMutex.Lock()
+	defer d.appendMutex.Unlock()
+
+	ms := uint64(now.UnixNano() / int64(time.Millisecond))
+	if ms <= d.appendTime {
+		// Same (or an earlier, if the clock stepped back) millisecond:
+		// stay on the last timestamp and bump the random part.
+		d.appendLo++
+		if d.appendLo == 0 {
+			d.appendHi++
+		}
+		return encodeAppendKey(d.appendTime, d.appendHi, d.appendLo), nil
+	}
+
+	var entropy [10]byte
+	if _, err := rand.Read(entropy[:]); err != nil {
+		return "", err
+	}
+
+	d.appendTime = ms
+	d.appendHi = binary.BigEndian.Uint16(entropy[:2])
+	d.appendLo = binary.BigEndian.Uint64(entropy[2:])
+	return encodeAppendKey(d.appendTime, d.appendHi, d.appendLo), nil
+}
+
+func encodeAppendKey(ms uint64, hi uint16, lo uint64) string {
+	var key [appendKeyLength]byte
+
+	for i := 25; i >= 10; i-- {
+		key[i] = crockford[lo&31]
+		lo = lo>>5 | uint64(hi)<<59
+		hi >>= 5
+	}
+	for i := 9; i >= 0; i-- {
+		key[i] = crockford[ms&31]
+		ms >>= 5
+	}
+	return string(key[:])
+}
+
+// appendKeyTime decodes the timestamp from a record key.
+func appendKeyTime(key string) (time.Time, bool) {
+	if len(key) != appendKeyLength {
+		return time.Time{}, false
+	}
+
+	var ms int64
+	for i := 0; i < 10; i++ {
+		n := strings.IndexByte(crockford, key[i])
+		if n < 0 {
+			return time.Time{}, false
+		}
+		ms = ms<<5 | int64(n)
+	}
+	return time.Unix(0, ms*int64(time.Millisecond)), true
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Attachments are binary files owned by a record, stored outside its JSON:
+//
+//	users/.attachments/john/avatar.png
+//
+// They are removed along with their record by Delete.
+const attachmentsDir = ".attachments"
+
+// AttachmentInfo describes a stored attachment. ContentType is sniffed from
+// the first bytes of the content.
+type AttachmentInfo struct {
+	Name        string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// PutAttachment stores the content of r as the named attachment of an
+// existing record, replacing any previous one. The content is streamed to a
+// temporary file and renamed into place, so readers never see a partial
+// attachment. Content beyond Options.MaxAttachmentSize fails with
+// ErrAttachmentTooLarge.
+func (d *Driver) PutAttachment(collection, resource, name string, r io.Reader) error {
+	if name == "" {
+		return ErrMissingAttachment
+	}
+
+	dir, err := d.attachmentDir(collection, resource, name)
+	if err != nil {
+		return err
+	}
+	collection, resource, _ = d.transformKeys(collection, resource)
+
+	// Checked again under the lock; this keeps a missing record from
+	// creating directories.
+	if _, err := os.Stat(d.recordPath(collection, resource)); os.IsNotExist(err) {
+		return ErrNotFound
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(dir, "."+name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	src := r
+	if d.maxAttachmentSize > 0 {
+		src = io.LimitReader(r, d.maxAttachmentSize+1)
+	}
+
+	n, err := io.Copy(tmp, src)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	if d.maxAttachmentSize > 0 && n > d.maxAttachmentSize {
+		return fmt.Errorf("%s: %w", name, ErrAttachmentTooLarge)
+	}
+
+	mutex, err := d.lockWritable(collection)
+	if err != nil {
+		return err
+	}
+	defer mutex.Unlock()
+
+	if _, err := os.Stat(d.recordPath(collection, resource)); os.IsNotExist(err) {
+		return ErrNotFound
+	}
+
+	path := filepath.Join(dir, name)
+	if err := d.checkInsert(collection, path); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	d.scheduleSync(path, dir)
+	return nil
+}
+
+// GetAttachment opens the named attachment of a record. The caller must close
+// the returned reader.
+func (d *Driver) GetAttachment(collection, resource, name string) (io.ReadCloser, AttachmentInfo, error) {
+	f, info, err := d.openAttachment(collection, resource, name)
+	if err != nil {
+		return nil, AttachmentInfo{}, err
+	}
+	return f, info, nil
+}
+
+// ListAttachments describes the attachments of a record, sorted by name.
+func (d *Driver) ListAttachments(collection, resource string) ([]AttachmentInfo, error) {
+	dir, err := d.attachmentDir(collection, resource, "")
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []AttachmentInfo
+	for _, file := range files {
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+
+		f, info, err := d.openAttachment(collection, resource, file.Name())
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		f.Close()
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos, nil
+}
+
+// DeleteAttachment removes the named attachment of a record.
+func (d *Driver) DeleteAttachment(collection, resource, name string) error {
+	if name == "" {
+		return ErrMissingAttachment
+	}
+
+	dir, err := d.attachmentDir(collection, resource, name)
+	if err != nil {
+		return err
+	}
+	collection, _, _ = d.transformKeys(collection, "")
+
+	mutex, err := d.lockMutable(collection)
+	if err != nil {
+		return err
+	}
+	defer mutex.Unlock()
+
+	path := filepath.Join(dir, name)
+	if err := os.Remove(path); os.IsNotExist(err) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+
+	// Drop the record's directory once its last attachment is gone.
+	os.Remove(dir)
+	d.scheduleSync(dir)
+	return nil
+}
+
+// ServeAttachment writes an attachment to w using http.ServeContent, with
+// its sniffed content type. Like ServeRecord it returns ErrNotFound without
+// writing a response if the attachment does not exist.
+func (d *Driver) ServeAttachment(w http.ResponseWriter, r *http.Request, collection, resource, name string) error {
+	f, info, err := d.openAttachment(collection, resource, name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", info.ContentType)
+	http.ServeContent(w, r, name, info.ModTime, f)
+	return nil
+}
+
+func (d *Driver) openAttachment(collection, resource, name string) (*os.File, AttachmentInfo, error) {
+	if name == "" {
+		return nil, AttachmentInfo{}, ErrMissingAttachment
+	}
+
+	dir, err := d.attachmentDir(collection, resource, name)
+	if err != nil {
+		return nil, AttachmentInfo{}, err
+	}
+	collection, _, _ = d.transformKeys(collection, "")
+
+	if err := d.checkFrozen(collection); err != nil {
+		return nil, AttachmentInfo{}, err
+	}
+
+	f, err := os.Open(filepath.Join(dir, name))
+	if os.IsNotExist(err) {
+		return nil, AttachmentInfo{}, ErrNotFound
+	}
+	if err != nil {
+		return nil, AttachmentInfo{}, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, AttachmentInfo{}, err
+	}
+
+	var sniff [512]byte
+	n, _ := io.ReadFull(f, sniff[:])
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, AttachmentInfo{}, err
+	}
+
+	return f, AttachmentInfo{
+		Name:        name,
+		Size:        fi.Size(),
+		ContentType: http.DetectContentType(sniff[:n]),
+		ModTime:     fi.ModTime(),
+	}, nil
+}
+
+// attachmentDir returns the directory holding a record's attachments,
+// checking name unless it is empty.
+func (d *Driver) attachmentDir(collection, resource, name string) (string, error) {
+	collection, resource, err := d.transformKeys(collection, resource)
+	if err != nil {
+		return "", err
+	}
+
+	if collection == "" {
+		return "", ErrMissingCollection
+	}
+
+	if resource == "" {
+		return "", ErrMissingResource
+	}
+
+	if strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("Invalid attachment name- %q", name)
+	}
+
+	return filepath.Join(d.dir, collection, attachmentsDir, resource), nil
+}
+
+// attachmentsPath is the directory holding a record's attachments.
+func (d *Driver) attachmentsPath(collection, resource string) string {
+	return filepath.Join(d.dir, collection, attachmentsDir, resource)
+}
+
+// hasAttachments reports whether a record has an attachments directory.
+func (d *Driver) hasAttachments(collection, resource string) bool {
+	_, err := os.Stat(d.attachmentsPath(collection, resource))
+	return err == nil
+}
+
+// removeAttachments deletes every attachment of a record, or of every record
+// under a directory such as an append-only day. Callers must hold the
+// collection mutex.
+func (d *Driver) removeAttachments(collection, resource string) error {
+	return os.RemoveAll(d.attachmentsPath(collection, resource))
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var pngHeader = "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+
+func TestAttachmentSizeLimit(t *testing.T) {
+	db := newTestDriver(t, &Options{MaxAttachmentSize: 8})
+	db.Write("users", "john", benchUser)
+
+	putAttachment(t, db, "users", "john", "note.txt", "12345678")
+	err := db.PutAttachment("users", "john", "note.txt", strings.NewReader("123456789"))
+	if !errors.Is(err, ErrAttachmentTooLarge) {
+		t.Fatalf("PutAttachment over the limit = %v, want ErrAttachmentTooLarge", err)
+	}
+
+	// The rejected content replaced nothing and left no temporary file.
+	expectAttachments(t, db, "users", "john", map[string]string{"note.txt": "12345678"})
+	files, _ := ioutil.ReadDir(filepath.Join(db.Dir(), "users", attachmentsDir, "john"))
+	if len(files) != 1 {
+		t.Fatalf("attachment directory holds %d files, want 1", len(files))
+	}
+}
+
+func TestAttachmentContentType(t *testing.T) {
+	db := newTestDriver(t, nil)
+	db.Write("users", "john", benchUser)
+	putAttachment(t, db, "users", "john", "avatar", pngHeader)
+	putAttachment(t, db, "users", "john", "bio", "plain words")
+
+	for name, want := range map[string]string{"avatar": "image/png", "bio": "text/plain; charset=utf-8"} {
+		r, info, err := db.GetAttachment("users", "john", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Close()
+		if info.ContentType != want {
+			t.Errorf("%s content type = %q, want %q", name, info.ContentType, want)
+		}
+
+		w := httptest.NewRecorder()
+		if err := db.ServeAttachment(w, httptest.NewRequest(http.MethodGet, "/", nil), "users", "john", name); err != nil {
+			t.Fatal(err)
+		}
+		if got := w.Header().Get("Content-Type"); got != want {
+			t.Errorf("served %s as %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestListAttachments(t *testing.T) {
+	db := newTestDriver(t, nil)
+	db.Write("users", "john", benchUser)
+
+	if infos, err := db.ListAttachments("users", "john"); err != nil || len(infos) != 0 {
+		t.Fatalf("ListAttachments before any = %v, %v", infos, err)
+	}
+
+	putAttachment(t, db, "users", "john", "b.txt", "bee")
+	putAttachment(t, db, "users", "john", "a.txt", "a")
+	infos, err := db.ListAttachments("users", "john")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 || infos[0].Name != "a.txt" || infos[1].Name != "b.txt" {
+		t.Fatalf("ListAttachments = %+v, want a.txt then b.txt", infos)
+	}
+	if infos[0].Size != 1 || infos[1].Size != 3 {
+		t.Fatalf("sizes = %d, %d, want 1, 3", infos[0].Size, infos[1].Size)
+	}
+
+	if err := db.DeleteAttachment("users", "john", "a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	expectAttachments(t, db, "users", "john", map[string]string{"b.txt": "bee"})
+	if err := db.DeleteAttachment("users", "john", "a.txt"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("DeleteAttachment of a deleted attachment = %v, want ErrNotFound", err)
+	}
+}
+
+func TestAttachmentErrors(t *testing.T) {
+	db := newTestDriver(t, nil)
+	db.Write("users", "john", benchUser)
+
+	if err := db.PutAttachment("users", "nobody", "a.txt", strings.NewReader("x")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("PutAttachment on a missing record = %v, want ErrNotFound", err)
+	}
+	if _, err := os.Stat(filepath.Join(db.Dir(), "users", attachmentsDir, "nobody")); !os.IsNotExist(err) {
+		t.Errorf("PutAttachment on a missing record created its directory: %v", err)
+	}
+	if err := db.PutAttachment("users", "john", "", strings.NewReader("x")); !errors.Is(err, ErrMissingAttachment) {
+		t.Errorf("PutAttachment without a name = %v, want ErrMissingAttachment", err)
+	}
+	for _, name := range []string{".hidden", "../x", `a\b`} {
+		if err := db.PutAttachment("users", "john", name, strings.NewReader("x")); err == nil {
+			t.Errorf("PutAttachment(%q) succeeded", name)
+		}
+	}
+	if _, _, err := db.GetAttachment("users", "john", "none"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetAttachment of a missing attachment = %v, want ErrNotFound", err)
+	}
+}
+
+func TestDeleteRemovesAttachments(t *testing.T) {
+	db := newTestDriver(t, nil)
+	db.Write("users", "john", benchUser)
+	db.Write("users", "mary", benchUser)
+	putAttachment(t, db, "users", "john", "a.txt", "a")
+	putAttachment(t, db, "users", "mary", "m.txt", "m")
+
+	if err := db.Delete("users", "john"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(db.Dir(), "users", attachmentsDir, "john")); !os.IsNotExist(err) {
+		t.Fatalf("attachments left after Delete: %v", err)
+	}
+	expectAttachments(t, db, "users", "mary", map[string]string{"m.txt": "m"})
+
+	// A record written again under the name starts without attachments.
+	db.Write("users", "john", benchUser)
+	expectAttachments(t, db, "users", "john", nil)
+}
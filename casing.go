@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"unicode"
+	"unicode/utf8"
+)
+
+// FieldCasing is a canonical casing for record field names.
+type FieldCasing int
+
+const (
+	// FieldCasingNone leaves field names as written.
+	FieldCasingNone FieldCasing = iota
+	// FieldCasingPascal upper-cases the first letter: "name" becomes "Name".
+	FieldCasingPascal
+	// FieldCasingCamel lower-cases the leading capitals: "Name" becomes
+	// "name" and "HTTPPort" becomes "httpPort".
+	FieldCasingCamel
+)
+
+func (c FieldCasing) apply(name string) string {
+	switch c {
+	case FieldCasingPascal:
+		r, size := utf8.DecodeRuneInString(name)
+		if r == utf8.RuneError || unicode.IsUpper(r) {
+			return name
+		}
+		return string(unicode.ToUpper(r)) + name[size:]
+	case FieldCasingCamel:
+		runes := []rune(name)
+		for i := 0; i < len(runes) && unicode.IsUpper(runes[i]); i++ {
+			// Keep the last capital of an acronym if it starts a word.
+			if i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1]) {
+				break
+			}
+			runes[i] = unicode.ToLower(runes[i])
+		}
+		return string(runes)
+	}
+	return name
+}
+
+// normalizeFields rewrites the field names of a record to Options.FieldCasing,
+// descending into nested objects and arrays with Options.NestedFieldCasing.
+// If a record has a field under both spellings the canonical one is kept.
+// Records that are not objects, or already canonical, are returned as is.
+func (d *Driver) normalizeFields(b []byte) []byte {
+	if d.fieldCasing == FieldCasingNone {
+		return b
+	}
+
+	value, changed := d.normalizeValue(bytes.TrimSpace(b))
+	if !changed {
+		return b
+	}
+
+	out, err := json.MarshalIndent(value, "", "\t")
+	if err != nil {
+		return b
+	}
+	return append(out, '\n')
+}
+
+func (d *Driver) normalizeValue(raw json.RawMessage) (interface{}, bool) {
+	switch {
+	case len(raw) > 0 && raw[0] == '{':
+		obj, err := decodeObject(raw)
+		if err != nil {
+			return raw, false
+		}
+		return d.normalizeObject(obj)
+	case len(raw) > 0 && raw[0] == '[' && d.nestedFieldCasing:
+		var elems []json.RawMessage
+		if err := json.Unmarshal(raw, &elems); err != nil {
+			return raw, false
+		}
+		values := make([]interface{}, len(elems))
+		changed := false
+		for i, elem := range elems {
+			var c bool
+			values[i], c = d.normalizeValue(elem)
+			changed = changed || c
+		}
+		return values, changed
+	}
+	return raw, false
+}
+
+func (d *Driver) normalizeObject(obj object) (object, bool) {
+	canonical := make(map[string]bool, len(obj))
+	for _, field := range obj {
+		if d.fieldCasing.apply(field.name) == field.name {
+			canonical[field.name] = true
+		}
+	}
+
+	changed := false
+	out := make(object, 0, len(obj))
+	for _, field := range obj {
+		if name := d.fieldCasing.apply(field.name); name != field.name {
+			changed = true
+			if canonical[name] {
+				continue
+			}
+			canonical[name] = true
+			field.name = name
+		}
+
+		if d.nestedFieldCasing {
+			var c bool
+			field.value, c = d.normalizeValue(field.value.(json.RawMessage))
+			changed = changed || c
+		}
+		out = append(out, field)
+	}
+	return out, changed
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestFieldCasingReadsCamelCaseIntoPascalStruct(t *testing.T) {
+	db := newTestDriver(t, &Options{FieldCasing: FieldCasingPascal, NestedFieldCasing: true})
+	db.Write("users", "john", benchUser)
+	writeOutside(t, db, "users", "jane", `{"name": "jane", "age": 30, "address": {"city": "Paris", "pinCode": 75001}}`)
+
+	var jane User
+	if err := db.Read("users", "jane", &jane); err != nil {
+		t.Fatal(err)
+	}
+	want := User{Name: "jane", Age: "30", Address: Address{City: "Paris", PinCode: "75001"}}
+	if !reflect.DeepEqual(jane, want) {
+		t.Fatalf("Read = %+v, want %+v", jane, want)
+	}
+
+	// Generic decoding sees one spelling across records too.
+	records, err := db.ReadAll("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range records {
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(record), &fields); err != nil {
+			t.Fatal(err)
+		}
+		address, _ := fields["Address"].(map[string]interface{})
+		if _, ok := fields["Name"]; !ok || address["City"] == nil {
+			t.Fatalf("record not normalized: %s", record)
+		}
+	}
+}
+
+func TestFieldCasingTopLevelOnly(t *testing.T) {
+	db := newTestDriver(t, &Options{FieldCasing: FieldCasingCamel})
+	db.Write("users", "john", map[string]interface{}{"Name": "john", "Address": map[string]string{"City": "Paris"}})
+
+	b, err := os.ReadFile(db.recordPath("users", "john"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]map[string]interface{}
+	json.Unmarshal(b, &fields)
+	if _, ok := fields["address"]["City"]; !ok {
+		t.Fatalf("stored %s, want top-level fields camelCased and nested ones untouched", b)
+	}
+}
+
+func TestFieldCasingKeepsCanonicalSpelling(t *testing.T) {
+	db := newTestDriver(t, &Options{FieldCasing: FieldCasingPascal})
+	writeOutside(t, db, "users", "x", `{"name": "lower", "Name": "upper"}`)
+
+	b, err := db.readRecord("users", "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]string
+	json.Unmarshal(b, &fields)
+	if !reflect.DeepEqual(fields, map[string]string{"Name": "upper"}) {
+		t.Fatalf("normalized to %s, want only the canonical Name", b)
+	}
+}
+
+func TestFieldCasingApply(t *testing.T) {
+	for _, tc := range []struct {
+		casing   FieldCasing
+		in, want string
+	}{
+		{FieldCasingPascal, "name", "Name"},
+		{FieldCasingPascal, "Name", "Name"},
+		{FieldCasingPascal, "pinCode", "PinCode"},
+		{FieldCasingCamel, "Name", "name"},
+		{FieldCasingCamel, "HTTPPort", "httpPort"},
+		{FieldCasingCamel, "ID", "id"},
+		{FieldCasingNone, "name", "name"},
+	} {
+		if got := tc.casing.apply(tc.in); got != tc.want {
+			t.Errorf("casing %d: apply(%q) = %q, want %q", tc.casing, tc.in, got, tc.want)
+		}
+	}
+}
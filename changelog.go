@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// changesCollection holds the entries written with Options.TrackChanges:
+//
+//	_changes/20261014T093012.123456789Z_users_john.json
+const changesCollection = "_changes"
+
+// ChangeEntry is one recorded change to a record. Op is "create",
+// "update" or "delete".
+type ChangeEntry struct {
+	Collection string        `json:"collection"`
+	Resource   string        `json:"resource"`
+	Op         string        `json:"op"`
+	Changes    []FieldChange `json:"changes"`
+	Time       time.Time     `json:"ts"`
+}
+
+// GetChangeLog returns the changes recorded for a record with
+// Options.TrackChanges, oldest first.
+func (d *Driver) GetChangeLog(collection, resource string) ([]ChangeEntry, error) {
+	collection, resource, err := d.transformKeys(collection, resource)
+	if err != nil {
+		return nil, err
+	}
+
+	if collection == "" {
+		return nil, ErrMissingCollection
+	}
+
+	if resource == "" {
+		return nil, ErrMissingResource
+	}
+
+	var entries []ChangeEntry
+	err = d.forEachFile(changesCollection, func(name string, b []byte) error {
+		var entry ChangeEntry
+		if err := json.Unmarshal(b, &entry); err != nil {
+			return d.decodeError(changesCollection, name, b, err)
+		}
+		if entry.Collection == collection && entry.Resource == resource {
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+	return entries, nil
+}
+
+// untrackedCollections are the driver's own collections, left out of the
+// change log.
+var untrackedCollections = map[string]bool{
+	changesCollection:   true,
+	sagasCollection:     true,
+	snapshotsCollection: true,
+}
+
+// tracked reports whether changes to a collection are logged.
+func (d *Driver) tracked(collection string) bool {
+	return d.trackChanges && !untrackedCollections[collection]
+}
+
+// previousVersion returns the stored content of a record ahead of a write
+// or delete, nil if there is none, and whether changes to the collection
+// are tracked at all. Callers must hold the collection mutex.
+func (d *Driver) previousVersion(collection, resource string) ([]byte, bool) {
+	if !d.tracked(collection) {
+		return nil, false
+	}
+
+	b, err := d.readFile(d.recordPath(collection, resource))
+	if err != nil {
+		return nil, true
+	}
+	return b, true
+}
+
+// recordChange stores the diff from before to after, either of which is nil
+// for a create or delete, in the change log if tracked is set. A change that
+// can't be recorded is logged rather than failing the write that made it.
+func (d *Driver) recordChange(collection, resource string, tracked bool, before, after []byte) {
+	if !tracked {
+		return
+	}
+
+	op := "update"
+	switch {
+	case after == nil:
+		op, after = "delete", []byte("{}")
+	case before == nil:
+		op, before = "create", []byte("{}")
+	}
+
+	changes, err := RecordDiff(before, after)
+	if err != nil {
+		d.logger.Warn("Unable to record change to %s/%s: %v", collection, resource, err)
+		return
+	}
+
+	now := time.Now().UTC()
+	entry := ChangeEntry{Collection: collection, Resource: resource, Op: op, Changes: changes, Time: now}
+	b, err := json.MarshalIndent(entry, "", "\t")
+	if err != nil {
+		d.logger.Warn("Unable to record change to %s/%s: %v", collection, resource, err)
+		return
+	}
+
+	name := now.Format("20060102T150405.000000000Z") + "_" + collection + "_" + strings.NewReplacer("/", "_", `\`, "_").Replace(resource)
+
+	mutex, err := d.lockCollection(changesCollection)
+	if err != nil {
+		d.logger.Warn("Unable to record change to %s/%s: %v", collection, resource, err)
+		return
+	}
+	defer mutex.Unlock()
+
+	if err := d.write(changesCollection, name, append(b, '\n')); err != nil {
+		d.logger.Warn("Unable to record change to %s/%s: %v", collection, resource, err)
+	}
+}
+
+// readForRemoval reads the records under prefix, a day directory or "" for
+// the whole collection, ahead of removing them all at once, so they can be
+// passed to recordRemovals. It returns nil if the collection isn't tracked.
+// Callers must hold the collection mutex.
+func (d *Driver) readForRemoval(collection, prefix string) map[string][]byte {
+	if !d.tracked(collection) {
+		return nil
+	}
+
+	removed := make(map[string][]byte)
+	for _, name := range d.recordNames(filepath.Join(d.dir, collection, prefix)) {
+		resource := filepath.Join(prefix, name)
+		if b, err := d.readFile(d.recordPath(collection, resource)); err == nil {
+			removed[resource] = b
+		}
+	}
+	return removed
+}
+
+// recordRemovals logs the records read by readForRemoval as deleted.
+func (d *Driver) recordRemovals(collection string, removed map[string][]byte) {
+	resources := make([]string, 0, len(removed))
+	for resource := range removed {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+
+	for _, resource := range resources {
+		d.recordChange(collection, resource, true, removed[resource], nil)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// changeOps returns the ops logged for a record, oldest first.
+func changeOps(t *testing.T, db *Driver, collection, resource string) []string {
+	t.Helper()
+	entries, err := db.GetChangeLog(collection, resource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ops []string
+	for _, entry := range entries {
+		ops = append(ops, entry.Op)
+	}
+	return ops
+}
+
+func expectOps(t *testing.T, db *Driver, collection, resource string, want ...string) {
+	t.Helper()
+	if got := changeOps(t, db, collection, resource); !reflect.DeepEqual(got, want) {
+		t.Errorf("%s/%s change log = %v, want %v", collection, resource, got, want)
+	}
+}
+
+func TestChangeLogWriteAndDelete(t *testing.T) {
+	db := newTestDriver(t, &Options{TrackChanges: true})
+	db.Write("users", "john", map[string]int{"age": 1})
+	db.Write("users", "john", map[string]int{"age": 2})
+	db.Delete("users", "john")
+	expectOps(t, db, "users", "john", "create", "update", "delete")
+
+	entries, _ := db.GetChangeLog("users", "john")
+	want := []FieldChange{{Field: "age", OldValue: float64(1), NewValue: float64(2)}}
+	if !reflect.DeepEqual(entries[1].Changes, want) {
+		t.Fatalf("update changes = %+v, want %+v", entries[1].Changes, want)
+	}
+}
+
+func TestChangeLogCoversEveryMutation(t *testing.T) {
+	db := newTestDriver(t, &Options{TrackChanges: true})
+
+	db.Write("users", "a", map[string]int{"n": 1})
+	db.Write("users", "b", map[string]int{"n": 2})
+	if err := db.Promote("users", "a", "c"); err != nil {
+		t.Fatal(err)
+	}
+	expectOps(t, db, "users", "c", "create")
+
+	if err := db.Swap("users", "a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	expectOps(t, db, "users", "a", "create", "update")
+	expectOps(t, db, "users", "b", "create", "update")
+
+	match := func(json.RawMessage) (bool, error) { return true, nil }
+	if _, err := db.RelocateWhere("users", "archive", match); err != nil {
+		t.Fatal(err)
+	}
+	expectOps(t, db, "users", "c", "create", "delete")
+	expectOps(t, db, "archive", "c", "create")
+
+	key, err := db.InsertContentAddressed("blobs", map[string]string{"v": "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectOps(t, db, "blobs", key, "create")
+
+	if err := db.Delete("archive", ""); err != nil {
+		t.Fatal(err)
+	}
+	expectOps(t, db, "archive", "a", "create", "delete")
+}
+
+func TestChangeLogAppendAndPurge(t *testing.T) {
+	db := newTestDriver(t, &Options{TrackChanges: true})
+	key, err := db.Append("log", map[string]string{"msg": "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	at, _ := appendKeyTime(key)
+	resource := filepath.Join(at.UTC().Format(appendDayLayout), key)
+	expectOps(t, db, "log", resource, "create")
+
+	if err := db.PurgeBefore("log", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	expectOps(t, db, "log", resource, "create", "delete")
+}
+
+func TestChangeLogPurgeImmutableAndRecompact(t *testing.T) {
+	db := newTestDriver(t, &Options{TrackChanges: true})
+	db.Write("ledger", "old", map[string]int{"n": 1})
+	if err := db.SetCollectionImmutable("ledger", true, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PurgeImmutable("ledger", time.Now().Add(time.Hour), true); err != nil {
+		t.Fatal(err)
+	}
+	expectOps(t, db, "ledger", "old", "create", "delete")
+
+	db.Write("users", "john", map[string]int{"n": 1})
+	if err := os.WriteFile(db.recordPath("users", "john"), []byte(`{"n":1}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	report, err := db.Recompact("users")
+	if err != nil || report.Rewritten != 1 {
+		t.Fatalf("Recompact = %+v, %v", report, err)
+	}
+	expectOps(t, db, "users", "john", "create", "update")
+}
+
+func TestChangeLogOff(t *testing.T) {
+	db := newTestDriver(t, nil)
+	db.Write("users", "john", map[string]int{"n": 1})
+	if ops := changeOps(t, db, "users", "john"); len(ops) != 0 {
+		t.Fatalf("change log without TrackChanges = %v", ops)
+	}
+}
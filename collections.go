@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Collections whose names start with an underscore, like _changes, _sagas
+// and _snapshots, hold the driver's own bookkeeping. They are not listed
+// by CollectionsWhere and do not count towards Options.MaxCollections.
+func internalCollection(name string) bool {
+	return strings.HasPrefix(name, "_")
+}
+
+type collectionInfo struct {
+	name  string
+	count int
+	size  int64
+}
+
+// Dir returns the absolute path of the database directory.
+func (d *Driver) Dir() string {
+	if dir, err := filepath.Abs(d.dir); err == nil {
+		return dir
+	}
+	return d.dir
+}
+
+// CollectionPath returns the absolute path of a collection's directory,
+// which need not exist yet. Names that are empty, contain a path separator,
+// or start with a dot, like "..", are rejected.
+func (d *Driver) CollectionPath(collection string) (string, error) {
+	collection, _, err := d.transformKeys(collection, "")
+	if err != nil {
+		return "", err
+	}
+
+	if collection == "" {
+		return "", ErrMissingCollection
+	}
+
+	if strings.HasPrefix(collection, ".") || strings.ContainsAny(collection, `/\`) {
+		return "", fmt.Errorf("Invalid collection- %q is not a valid collection name", collection)
+	}
+
+	return filepath.Join(d.Dir(), collection), nil
+}
+
+// CollectionsWhere returns the names of the collections whose record count
+// and total record size satisfy pred. The database directory is walked once.
+// Internal collections are left out.
+func (d *Driver) CollectionsWhere(pred func(name string, count int, size int64) bool) ([]string, error) {
+	var infos []*collectionInfo
+	var current *collectionInfo
+
+	err := filepath.WalkDir(d.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(d.dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		depth := strings.Count(rel, string(filepath.Separator))
+		switch {
+		case depth == 0 && entry.IsDir():
+			if strings.HasPrefix(entry.Name(), ".") || internalCollection(entry.Name()) {
+				return filepath.SkipDir
+			}
+			current = &collectionInfo{name: entry.Name()}
+			infos = append(infos, current)
+		case depth > 0 && strings.HasPrefix(entry.Name(), "."):
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+		case depth == 1 && entry.IsDir() && !d.recordDirs,
+			depth == 2 && entry.IsDir():
+			return filepath.SkipDir
+		case depth == 1 && !d.recordDirs && strings.HasSuffix(entry.Name(), ".json") &&
+			!reservedResources[strings.TrimSuffix(entry.Name(), ".json")],
+			depth == 2 && entry.Name() == recordDataFile:
+			fi, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			current.count++
+			current.size += fi.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, info := range infos {
+		if pred(info.name, info.count, info.size) {
+			names = append(names, info.name)
+		}
+	}
+	return names, nil
+}
+
+// ensureCollection enforces Options.MaxCollections before a write that may
+// create a new collection directory.
+func (d *Driver) ensureCollection(collection string) error {
+	if d.maxCollections <= 0 || internalCollection(collection) {
+		return nil
+	}
+
+	dir := filepath.Join(d.dir, collection)
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	}
+
+	d.collectionsMutex.Lock()
+	defer d.collectionsMutex.Unlock()
+
+	files, err := ioutil.ReadDir(d.dir)
+	if err != nil {
+		return err
+	}
+
+	count := 0
+	for _, file := range files {
+		if file.Name() == collection {
+			return nil
+		}
+		if file.IsDir() && !strings.HasPrefix(file.Name(), ".") && !internalCollection(file.Name()) {
+			count++
+		}
+	}
+
+	if count >= d.maxCollections {
+		return fmt.Errorf("%s: %w", collection, ErrTooManyCollections)
+	}
+	return os.MkdirAll(dir, 0755)
+}
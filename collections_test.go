@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestMaxCollections(t *testing.T) {
+	db := newTestDriver(t, &Options{MaxCollections: 3})
+
+	for i := 0; i < 3; i++ {
+		if err := db.Write(fmt.Sprint("c", i), "a", benchUser); err != nil {
+			t.Fatalf("Write to collection %d of 3 = %v", i+1, err)
+		}
+	}
+	if err := db.Write("c3", "a", benchUser); !errors.Is(err, ErrTooManyCollections) {
+		t.Fatalf("Write to a fourth collection = %v, want ErrTooManyCollections", err)
+	}
+	if _, err := os.Stat(filepath.Join(db.Dir(), "c3")); !os.IsNotExist(err) {
+		t.Fatalf("rejected collection was created: %v", err)
+	}
+
+	// Existing collections can still be written.
+	if err := db.Write("c0", "b", benchUser); err != nil {
+		t.Fatalf("Write to an existing collection at the limit = %v", err)
+	}
+
+	// Deleting one makes room.
+	if err := db.Delete("c0", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Write("c3", "a", benchUser); err != nil {
+		t.Fatalf("Write after freeing a collection = %v", err)
+	}
+}
+
+func TestMaxCollectionsCountsExistingDirectories(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"old1", "old2", ".hidden"} {
+		os.Mkdir(filepath.Join(dir, name), 0755)
+	}
+
+	db, err := New(dir, &Options{MaxCollections: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Write("new1", "a", benchUser); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Write("new2", "a", benchUser); !errors.Is(err, ErrTooManyCollections) {
+		t.Fatalf("Write past existing directories = %v, want ErrTooManyCollections", err)
+	}
+}
+
+func TestMaxCollectionsConcurrent(t *testing.T) {
+	db := newTestDriver(t, &Options{MaxCollections: 5})
+
+	var wg sync.WaitGroup
+	errs := make([]error, 20)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = db.Write(fmt.Sprint("c", i), "a", benchUser)
+		}(i)
+	}
+	wg.Wait()
+
+	created := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			created++
+		case !errors.Is(err, ErrTooManyCollections):
+			t.Fatal(err)
+		}
+	}
+	if created != 5 {
+		t.Fatalf("created %d collections concurrently, want 5", created)
+	}
+}
+
+func TestMaxCollectionsUnlimited(t *testing.T) {
+	db := newTestDriver(t, nil)
+	for i := 0; i < 20; i++ {
+		if err := db.Write(fmt.Sprint("c", i), "a", benchUser); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCollectionsWhereCount(t *testing.T) {
+	db := newTestDriver(t, nil)
+	for collection, n := range map[string]int{"small": 1, "medium": 3, "large": 5} {
+		for i := 0; i < n; i++ {
+			if err := db.Write(collection, fmt.Sprint(i), benchUser); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	names, err := db.CollectionsWhere(func(name string, count int, size int64) bool {
+		return count > 2
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, []string{"large", "medium"}) {
+		t.Fatalf("CollectionsWhere(count > 2) = %v, want [large medium]", names)
+	}
+}
+
+func TestCollectionsWhereSize(t *testing.T) {
+	db := newTestDriver(t, nil)
+	db.Write("one", "a", benchUser)
+	db.Write("two", "a", benchUser)
+	db.Write("two", "b", benchUser)
+
+	sizes := make(map[string]int64)
+	if _, err := db.CollectionsWhere(func(name string, count int, size int64) bool {
+		sizes[name] = size
+		return false
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if sizes["one"] <= 0 || sizes["two"] != 2*sizes["one"] {
+		t.Fatalf("sizes = %v, want two to be twice one", sizes)
+	}
+}
+
+func TestCollectionsWhereSkipsReservedFiles(t *testing.T) {
+	db := newTestDriver(t, nil)
+	if err := db.SetRequiredFields("users", []string{"Name"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Write("users", "john", benchUser); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetCollectionReadOnly("users", true); err != nil {
+		t.Fatal(err)
+	}
+
+	var count int
+	names, err := db.CollectionsWhere(func(name string, n int, size int64) bool {
+		count = n
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, []string{"users"}) || count != 1 {
+		t.Fatalf("CollectionsWhere = %v with count %d, want [users] with 1", names, count)
+	}
+}
+
+func TestDir(t *testing.T) {
+	root := t.TempDir()
+	t.Chdir(root)
+
+	db, err := New("./data/../db/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if got, want := db.Dir(), filepath.Join(root, "db"); got != want {
+		t.Fatalf("Dir = %q, want %q", got, want)
+	}
+}
+
+func TestCollectionPath(t *testing.T) {
+	db := newTestDriver(t, nil)
+
+	path, err := db.CollectionPath("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(db.Dir(), "users"); path != want {
+		t.Fatalf("CollectionPath(users) = %q, want %q", path, want)
+	}
+
+	if _, err := db.CollectionPath(""); !errors.Is(err, ErrMissingCollection) {
+		t.Errorf("CollectionPath(\"\") = %v, want ErrMissingCollection", err)
+	}
+	for _, name := range []string{"..", ".", "../etc", "a/b", `a\b`, ".hidden"} {
+		if path, err := db.CollectionPath(name); err == nil {
+			t.Errorf("CollectionPath(%q) = %q, want an error", name, path)
+		}
+	}
+}
+
+func TestInternalCollectionsNotCounted(t *testing.T) {
+	db := newTestDriver(t, &Options{MaxCollections: 1, TrackChanges: true})
+
+	// The first write creates users and, for its change entry, _changes.
+	if err := db.Write("users", "john", benchUser); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Write("users", "john", User{Name: "johnny"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(db.Dir(), changesCollection)); err != nil {
+		t.Fatalf("no change log written: %v", err)
+	}
+
+	saga, err := NewSaga(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saga.AddStep("noop", func(*Driver) error { return nil }, nil)
+	if err := saga.Execute(context.Background()); err != nil {
+		t.Fatalf("saga at the collection limit = %v", err)
+	}
+
+	if err := db.Write("users", "jane", benchUser); err != nil {
+		t.Fatalf("Write to users with internal collections present = %v", err)
+	}
+	if err := db.Write("posts", "a", benchUser); !errors.Is(err, ErrTooManyCollections) {
+		t.Fatalf("Write to a second user collection = %v, want ErrTooManyCollections", err)
+	}
+
+	names, err := db.CollectionsWhere(func(string, int, int64) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, []string{"users"}) {
+		t.Fatalf("CollectionsWhere = %v, want only [users]", names)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// computeFields runs Options.ComputedFields against the marshaled record b
+// and sets each result as a top-level field, replacing any existing value.
+// Without computed fields b is returned as is.
+// Fields are applied in name order so the output is deterministic.
+func (d *Driver) computeFields(collection, resource string, b []byte) ([]byte, error) {
+	if len(d.computedFields) == 0 {
+		return b, nil
+	}
+
+	b = bytes.TrimSuffix(b, []byte("\n"))
+	obj, err := decodeObject(b)
+	if err != nil {
+		return nil, fmt.Errorf("Computed fields- %s/%s is not a JSON object: %w", collection, resource, err)
+	}
+
+	names := make([]string, 0, len(d.computedFields))
+	for name := range d.computedFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value, err := d.computedFields[name](collection, resource, b)
+		if err != nil {
+			return nil, fmt.Errorf("Computed field %s- %w", name, err)
+		}
+		obj = obj.set(name, value)
+	}
+	out, err := json.MarshalIndent(obj, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+// decodeObject splits a JSON object into its members, keeping their order.
+func decodeObject(b []byte) (object, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return nil, errors.New("not an object")
+	}
+
+	var obj object
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		obj = append(obj, objectField{name: tok.(string), value: value})
+	}
+	return obj, nil
+}
+
+func (o object) set(name string, value interface{}) object {
+	for i := range o {
+		if o[i].name == name {
+			o[i].value = value
+			return o
+		}
+	}
+	return append(o, objectField{name: name, value: value})
+}
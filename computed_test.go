@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+// lengthField computes the length of the record's name field.
+func lengthField(collection, resource string, data []byte) (interface{}, error) {
+	doc, err := decodeDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	name, _ := lookupField(doc, "name")
+	s, ok := name.(string)
+	if !ok {
+		return nil, errors.New("name is not a string")
+	}
+	return len(s), nil
+}
+
+func TestComputedFieldsWritten(t *testing.T) {
+	db := newTestDriver(t, &Options{ComputedFields: map[string]func(string, string, []byte) (interface{}, error){
+		"length": lengthField,
+		"key": func(collection, resource string, data []byte) (interface{}, error) {
+			return collection + "/" + resource, nil
+		},
+	}})
+
+	if err := db.Write("users", "john", map[string]interface{}{"name": "john", "length": 99}); err != nil {
+		t.Fatal(err)
+	}
+	expectComputed(t, db, "john", 4, "users/john")
+
+	// Changing the input recomputes the field on the next write.
+	if err := db.Write("users", "john", map[string]interface{}{"name": "johnny"}); err != nil {
+		t.Fatal(err)
+	}
+	expectComputed(t, db, "john", 6, "users/john")
+}
+
+func expectComputed(t *testing.T, db *Driver, resource string, length int, key string) {
+	t.Helper()
+	var got struct {
+		Name   string `json:"name"`
+		Length int    `json:"length"`
+		Key    string `json:"key"`
+	}
+	if err := db.Read("users", resource, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Length != length || got.Key != key {
+		t.Fatalf("computed fields = %+v, want length %d and key %s", got, length, key)
+	}
+}
+
+func TestComputedFieldErrors(t *testing.T) {
+	db := newTestDriver(t, &Options{ComputedFields: map[string]func(string, string, []byte) (interface{}, error){
+		"length": lengthField,
+	}})
+
+	err := db.Write("users", "john", map[string]interface{}{"name": 5})
+	if err == nil || !strings.HasPrefix(err.Error(), "Computed field length- ") {
+		t.Fatalf("Write with a failing computed field = %v", err)
+	}
+	if _, err := db.ReadValue("users", "john"); !os.IsNotExist(err) {
+		t.Fatalf("record stored despite the failure: %v", err)
+	}
+
+	err = db.Write("users", "list", []int{1})
+	if err == nil || !strings.HasPrefix(err.Error(), "Computed fields- users/list ") {
+		t.Fatalf("Write of a non-object = %v", err)
+	}
+}
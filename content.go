@@ -0,0 +1,49 @@
+package main
+
+import "encoding/hex"
+
+// InsertContentAddressed writes v under the hex digest of its JSON, hashed
+// with Options.HashFunc, and returns that key. Identical content always
+// gets the same key, so inserting it again does nothing. The digest is
+// taken before computed fields and field casing are applied.
+func (d *Driver) InsertContentAddressed(collection string, v interface{}) (string, error) {
+	collection, _, err := d.transformKeys(collection, "")
+	if err != nil {
+		return "", err
+	}
+
+	if collection == "" {
+		return "", ErrMissingCollection
+	}
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if err := d.marshalValue(buf, collection, v); err != nil {
+		return "", err
+	}
+
+	h := d.hashFunc()
+	h.Write(buf.Bytes())
+	key := hex.EncodeToString(h.Sum(nil))
+
+	mutex, err := d.lockWritable(collection)
+	if err != nil {
+		return "", err
+	}
+	defer mutex.Unlock()
+
+	if _, err := stat(d.recordPath(collection, key)); err == nil {
+		return key, nil
+	}
+
+	b, err := d.prepareGenerated(collection, key, buf.Bytes())
+	if err != nil {
+		return "", err
+	}
+
+	if err := d.writeRecord(collection, key, b); err != nil {
+		return "", err
+	}
+	return key, nil
+}
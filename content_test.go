@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInsertContentAddressedDedups(t *testing.T) {
+	db := newTestDriver(t, nil)
+
+	first, err := db.InsertContentAddressed("blobs", benchUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := db.InsertContentAddressed("blobs", benchUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != again {
+		t.Fatalf("identical content got keys %s and %s", first, again)
+	}
+
+	files, err := os.ReadDir(filepath.Join(db.Dir(), "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("%d files stored for identical content, want 1", len(files))
+	}
+
+	b, _ := os.ReadFile(db.recordPath("blobs", first))
+	sum := sha256.Sum256(b)
+	if first != hex.EncodeToString(sum[:]) {
+		t.Fatalf("key %s is not the SHA-256 of the stored record", first)
+	}
+
+	other := benchUser
+	other.Name = "jane"
+	if key, _ := db.InsertContentAddressed("blobs", other); key == first {
+		t.Fatal("different content got the same key")
+	}
+}
+
+func TestInsertContentAddressedHashFunc(t *testing.T) {
+	db := newTestDriver(t, &Options{HashFunc: md5.New})
+
+	key, err := db.InsertContentAddressed("blobs", benchUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(key) != 2*md5.Size {
+		t.Fatalf("key %s is not an MD5 digest", key)
+	}
+
+	var user User
+	if err := db.Read("blobs", key, &user); err != nil || user != benchUser {
+		t.Fatalf("Read = %+v, %v", user, err)
+	}
+}
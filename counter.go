@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const counterDir = ".counters"
+
+// Counter is a named int64 stored as a single number in .counters/<name>,
+// without the JSON encoding of a record. It is safe for concurrent use.
+type Counter struct {
+	d    *Driver
+	name string
+
+	mutex sync.Mutex
+	value int64
+	dirty bool
+}
+
+// Counter returns the named counter, loading its value from disk the first
+// time. Counters start at 0.
+func (d *Driver) Counter(name string) (*Counter, error) {
+	if name == "" || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\`) {
+		return nil, fmt.Errorf("Invalid counter- %q is not a valid counter name", name)
+	}
+
+	d.counterMutex.Lock()
+	defer d.counterMutex.Unlock()
+
+	if c, ok := d.counters[name]; ok {
+		return c, nil
+	}
+
+	c := &Counter{d: d, name: name}
+	b, err := d.readFile(filepath.Join(d.dir, counterDir, name))
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, err
+	default:
+		if c.value, err = strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64); err != nil {
+			return nil, fmt.Errorf("Corrupt counter- %s: %v", name, err)
+		}
+	}
+
+	d.counters[name] = c
+	return c, nil
+}
+
+// Counters returns the value of every counter, stored or in memory.
+func (d *Driver) Counters() (map[string]int64, error) {
+	files, err := ioutil.ReadDir(filepath.Join(d.dir, counterDir))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	values := make(map[string]int64)
+	for _, file := range files {
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".") || strings.HasSuffix(file.Name(), ".tmp") {
+			continue
+		}
+
+		c, err := d.Counter(file.Name())
+		if err != nil {
+			return nil, err
+		}
+		values[c.name] = c.Get()
+	}
+
+	d.counterMutex.Lock()
+	counters := make([]*Counter, 0, len(d.counters))
+	for _, c := range d.counters {
+		counters = append(counters, c)
+	}
+	d.counterMutex.Unlock()
+
+	for _, c := range counters {
+		values[c.name] = c.Get()
+	}
+	return values, nil
+}
+
+// Add adds delta to the counter and returns the new value. Unless
+// Options.CounterFlushInterval is set, the value is on disk when Add
+// returns; a failed write leaves the counter unchanged.
+func (c *Counter) Add(delta int64) (int64, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.store(c.value + delta); err != nil {
+		return 0, err
+	}
+	return c.value, nil
+}
+
+// Get returns the counter's current value.
+func (c *Counter) Get() int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.value
+}
+
+// Set replaces the counter's value, written to disk like Add.
+func (c *Counter) Set(v int64) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.store(v)
+}
+
+// store sets the value, writing it now or marking it for the next flush.
+// Callers must hold c.mutex.
+func (c *Counter) store(v int64) error {
+	if c.d.counterFlushInterval > 0 {
+		c.value, c.dirty = v, true
+		c.d.scheduleCounterFlush()
+		return nil
+	}
+
+	if err := c.d.writeCounter(c.name, v); err != nil {
+		return err
+	}
+	c.value = v
+	return nil
+}
+
+// FlushCounters writes every counter changed since the last flush. It runs
+// on its own every Options.CounterFlushInterval and in Close.
+func (d *Driver) FlushCounters() error {
+	d.counterMutex.Lock()
+	if d.counterTimer != nil {
+		d.counterTimer.Stop()
+		d.counterTimer = nil
+	}
+	counters := make([]*Counter, 0, len(d.counters))
+	for _, c := range d.counters {
+		counters = append(counters, c)
+	}
+	d.counterMutex.Unlock()
+
+	var firstErr error
+	for _, c := range counters {
+		c.mutex.Lock()
+		if c.dirty {
+			if err := d.writeCounter(c.name, c.value); err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+			} else {
+				c.dirty = false
+			}
+		}
+		c.mutex.Unlock()
+	}
+	return firstErr
+}
+
+func (d *Driver) scheduleCounterFlush() {
+	d.counterMutex.Lock()
+	defer d.counterMutex.Unlock()
+
+	if d.counterTimer == nil {
+		d.counterTimer = time.AfterFunc(d.counterFlushInterval, func() {
+			if err := d.FlushCounters(); err != nil {
+				d.logger.Error("Unable to flush counters in %s: %v", d.dir, err)
+			}
+		})
+	}
+}
+
+func (d *Driver) writeCounter(name string, v int64) error {
+	return d.writeFile(filepath.Join(d.dir, counterDir, name), []byte(strconv.FormatInt(v, 10)+"\n"))
+}
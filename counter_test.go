@@ -0,0 +1,82 @@
+package main
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCounterStress(t *testing.T) {
+	for _, interval := range []time.Duration{0, 5 * time.Millisecond} {
+		dir := t.TempDir()
+		db, err := New(dir, &Options{CounterFlushInterval: interval})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		const goroutines, adds = 32, 200
+		var wg sync.WaitGroup
+		for i := 0; i < goroutines; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c, err := db.Counter("hits")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				for j := 0; j < adds; j++ {
+					if _, err := c.Add(1); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		c, _ := db.Counter("hits")
+		if got := c.Get(); got != goroutines*adds {
+			t.Fatalf("interval %v: counter = %d, want %d", interval, got, goroutines*adds)
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// The total survives a restart, write-behind included.
+		if db, err = New(dir, nil); err != nil {
+			t.Fatal(err)
+		}
+		c, _ = db.Counter("hits")
+		if got := c.Get(); got != goroutines*adds {
+			t.Fatalf("interval %v: counter after restart = %d, want %d", interval, got, goroutines*adds)
+		}
+		db.Close()
+	}
+}
+
+func TestCounters(t *testing.T) {
+	db := newTestDriver(t, &Options{CounterFlushInterval: time.Hour})
+	a, _ := db.Counter("a")
+	b, _ := db.Counter("b")
+	a.Add(3)
+	b.Set(-2)
+
+	counters, err := db.Counters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int64{"a": 3, "b": -2}; !reflect.DeepEqual(counters, want) {
+		t.Fatalf("Counters = %v, want %v", counters, want)
+	}
+}
+
+func TestCounterRejectsInvalidNames(t *testing.T) {
+	db := newTestDriver(t, nil)
+	for _, name := range []string{"", "a/b"} {
+		if _, err := db.Counter(name); err == nil {
+			t.Errorf("Counter(%q) succeeded", name)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// FieldChange is a field that differs between two versions of a record.
+// Field is a dotted path as in GroupBy. OldValue is nil for an added field
+// and NewValue for a removed one, so a null field that was added or removed
+// has both nil. Values are decoded as in DistinctValues.
+type FieldChange struct {
+	Field    string
+	OldValue interface{}
+	NewValue interface{}
+}
+
+// RecordDiff compares two JSON objects and returns every field that was
+// changed, added or removed, sorted by path. Nested objects are compared
+// field by field; arrays and other values are compared whole, with numbers
+// equal by value.
+func RecordDiff(before, after []byte) ([]FieldChange, error) {
+	var objects [2]map[string]interface{}
+	for i, b := range [][]byte{before, after} {
+		doc, err := decodeDocument(b)
+		if err != nil {
+			return nil, err
+		}
+		obj, ok := doc.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Unable to diff- record is not a JSON object")
+		}
+		objects[i] = obj
+	}
+
+	var changes []FieldChange
+	diffObjects("", objects[0], objects[1], &changes)
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes, nil
+}
+
+func diffObjects(prefix string, before, after map[string]interface{}, changes *[]FieldChange) {
+	for name, old := range before {
+		field := prefix + name
+		value, ok := after[name]
+		if !ok {
+			*changes = append(*changes, FieldChange{Field: field, OldValue: old})
+			continue
+		}
+
+		oldObj, okOld := old.(map[string]interface{})
+		newObj, okNew := value.(map[string]interface{})
+		if okOld && okNew {
+			diffObjects(field+".", oldObj, newObj, changes)
+			continue
+		}
+
+		if distinctKey(old) != distinctKey(value) {
+			*changes = append(*changes, FieldChange{Field: field, OldValue: old, NewValue: value})
+		}
+	}
+
+	for name, value := range after {
+		if _, ok := before[name]; !ok {
+			*changes = append(*changes, FieldChange{Field: prefix + name, NewValue: value})
+		}
+	}
+}
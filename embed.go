@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/template"
+)
+
+// embedDataFile is the packed records file written next to the generated
+// source and embedded by it.
+const embedDataFile = "records.json"
+
+// ExportEmbedPackage writes a Go package named pkg to outDir that embeds a
+// frozen copy of a collection, so other programs can read it without the
+// driver. outDir receives records.json, one record per line in key order as
+// canonical JSON, and pkg.go, which embeds it and provides Get, Keys and
+// All. The output depends only on the records, so regenerating an
+// unchanged collection leaves both files byte for byte the same.
+func (d *Driver) ExportEmbedPackage(collection, pkg, outDir string) error {
+	collection, _, err := d.transformKeys(collection, "")
+	if err != nil {
+		return err
+	}
+
+	if !token.IsIdentifier(pkg) {
+		return fmt.Errorf("Invalid package name- %q", pkg)
+	}
+
+	records := make(map[string][]byte)
+	var keys []string
+	err = d.forEachRecord(collection, func(resource string, b []byte) error {
+		canonical, err := canonicalJSON(b)
+		if err != nil {
+			return d.decodeError(collection, resource, b, err)
+		}
+		records[resource] = canonical
+		keys = append(keys, resource)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(keys)
+
+	var data bytes.Buffer
+	data.WriteString("{")
+	for i, key := range keys {
+		if i > 0 {
+			data.WriteString(",")
+		}
+		name, _ := json.Marshal(key)
+		fmt.Fprintf(&data, "\n%s:%s", name, records[key])
+	}
+	data.WriteString("\n}\n")
+
+	var src bytes.Buffer
+	if err := embedTemplate.Execute(&src, struct{ Package, Collection, DataFile string }{pkg, collection, embedDataFile}); err != nil {
+		return err
+	}
+	code, err := format.Source(src.Bytes())
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(outDir, embedDataFile), data.Bytes(), 0644); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(outDir, pkg+".go"), code, 0644)
+}
+
+// canonicalJSON re-encodes a record compactly with object keys sorted,
+// keeping numbers as written.
+func canonicalJSON(b []byte) ([]byte, error) {
+	doc, err := decodeDocument(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+var embedTemplate = template.Must(template.New("embed").Parse(`// Code generated by ExportEmbedPackage from collection {{printf "%q" .Collection}}. DO NOT EDIT.
+
+// Package {{.Package}} holds a read-only copy of the {{.Collection}} collection.
+package {{.Package}}
+
+import (
+	_ "embed"
+	"encoding/json"
+	"sort"
+	"sync"
+)
+
+//go:embed {{.DataFile}}
+var packed []byte
+
+var (
+	loadOnce sync.Once
+	records  map[string]json.RawMessage
+	keys     []string
+)
+
+func load() {
+	loadOnce.Do(func() {
+		if err := json.Unmarshal(packed, &records); err != nil {
+			panic("{{.Package}}: corrupt {{.DataFile}}: " + err.Error())
+		}
+		for key := range records {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+	})
+}
+
+// Keys returns the keys of all records, sorted.
+func Keys() []string {
+	load()
+	return append([]string(nil), keys...)
+}
+
+// Get decodes the record stored under key into v and reports whether there
+// is one.
+func Get(key string, v interface{}) (bool, error) {
+	load()
+	raw, ok := records[key]
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(raw, v)
+}
+
+// All decodes every record, in key order, into v, which must point to a
+// slice.
+func All(v interface{}) error {
+	load()
+	list := make([]json.RawMessage, len(keys))
+	for i, key := range keys {
+		list[i] = records[key]
+	}
+	b, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+`))
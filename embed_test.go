@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type country struct {
+	Name       string
+	Capital    string
+	Population int64
+	Languages  []string
+}
+
+var countries = map[string]country{
+	"fr": {"France", "Paris", 68000000, []string{"French"}},
+	"ch": {"Switzerland", "Bern", 8800000, []string{"German", "French", "Italian", "Romansh"}},
+	"jp": {"Japan", "Tokyo", 124000000, []string{"Japanese"}},
+}
+
+func writeCountries(t *testing.T, db *Driver) {
+	t.Helper()
+	for key, c := range countries {
+		if err := db.Write("countries", key, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestExportEmbedPackageIsDeterministic(t *testing.T) {
+	db := newTestDriver(t, nil)
+	writeCountries(t, db)
+
+	first, second := t.TempDir(), t.TempDir()
+	if err := db.ExportEmbedPackage("countries", "countrydata", first); err != nil {
+		t.Fatal(err)
+	}
+	// Rewriting records in another order must not change the output.
+	for _, key := range []string{"jp", "fr", "ch"} {
+		db.Write("countries", key, countries[key])
+	}
+	if err := db.ExportEmbedPackage("countries", "countrydata", second); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{embedDataFile, "countrydata.go"} {
+		a, _ := os.ReadFile(filepath.Join(first, name))
+		b, _ := os.ReadFile(filepath.Join(second, name))
+		if len(a) == 0 || !bytes.Equal(a, b) {
+			t.Fatalf("%s differs between exports of the same records", name)
+		}
+	}
+}
+
+func TestExportEmbedPackageRejectsBadPackageName(t *testing.T) {
+	db := newTestDriver(t, nil)
+	writeCountries(t, db)
+	if err := db.ExportEmbedPackage("countries", "country-data", t.TempDir()); err == nil {
+		t.Fatal("ExportEmbedPackage with an invalid package name succeeded")
+	}
+}
+
+// TestExportEmbedPackageRoundTrip builds a program against the generated
+// package and compares what it reads back with the collection.
+func TestExportEmbedPackageRoundTrip(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a program")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go tool not found")
+	}
+
+	db := newTestDriver(t, nil)
+	writeCountries(t, db)
+
+	mod := t.TempDir()
+	if err := db.ExportEmbedPackage("countries", "countrydata", filepath.Join(mod, "countrydata")); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"go.mod": "module roundtrip\n\ngo 1.21\n",
+		"main.go": `package main
+
+import (
+	"encoding/json"
+	"os"
+
+	"roundtrip/countrydata"
+)
+
+type country struct {
+	Name       string
+	Capital    string
+	Population int64
+	Languages  []string
+}
+
+func main() {
+	byKey := make(map[string]country)
+	for _, key := range countrydata.Keys() {
+		var c country
+		if ok, err := countrydata.Get(key, &c); !ok || err != nil {
+			panic(key)
+		}
+		byKey[key] = c
+	}
+
+	var all []country
+	if err := countrydata.All(&all); err != nil {
+		panic(err)
+	}
+
+	json.NewEncoder(os.Stdout).Encode(map[string]interface{}{"keys": countrydata.Keys(), "byKey": byKey, "all": all})
+}
+`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(mod, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cmd := exec.Command(goTool, "run", ".")
+	cmd.Dir = mod
+	cmd.Env = append(os.Environ(), "GOWORK=off")
+	out, err := cmd.Output()
+	if err != nil {
+		if ee, ok := err.(*exec.ExitError); ok {
+			t.Fatalf("go run: %v\n%s", err, ee.Stderr)
+		}
+		t.Fatal(err)
+	}
+
+	var got struct {
+		Keys  []string
+		ByKey map[string]country
+		All   []country
+	}
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"ch", "fr", "jp"}; !reflect.DeepEqual(got.Keys, want) {
+		t.Fatalf("Keys = %v, want %v", got.Keys, want)
+	}
+	if !reflect.DeepEqual(got.ByKey, countries) {
+		t.Fatalf("Get returned %+v, want %+v", got.ByKey, countries)
+	}
+	if want := []country{countries["ch"], countries["fr"], countries["jp"]}; !reflect.DeepEqual(got.All, want) {
+		t.Fatalf("All = %+v, want %+v", got.All, want)
+	}
+}
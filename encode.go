@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// EmptyFieldPolicy controls how empty struct fields are written.
+type EmptyFieldPolicy int
+
+const (
+	// EmptyFieldsDefault honors each field's omitempty tag.
+	EmptyFieldsDefault EmptyFieldPolicy = iota
+	// EmptyFieldsInclude writes empty fields even if tagged omitempty.
+	EmptyFieldsInclude
+	// EmptyFieldsOmit drops empty fields even if not tagged omitempty.
+	EmptyFieldsOmit
+)
+
+var (
+	marshalerType     = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// maxPooledBuffer keeps unusually large records from pinning their buffers.
+const maxPooledBuffer = 64 << 10
+
+// encodeBuffer is a reusable buffer with an encoder writing records into it.
+// The encoder is pooled too, as it keeps its own scratch space for indenting.
+type encodeBuffer struct {
+	bytes.Buffer
+	enc *json.Encoder
+}
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		buf := &encodeBuffer{}
+		buf.enc = json.NewEncoder(&buf.Buffer)
+		buf.enc.SetIndent("", "\t")
+		return buf
+	},
+}
+
+func getBuffer() *encodeBuffer {
+	return bufferPool.Get().(*encodeBuffer)
+}
+
+func putBuffer(buf *encodeBuffer) {
+	if buf.Cap() > maxPooledBuffer {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
+
+// marshal encodes v into buf as tab-indented JSON followed by a newline,
+// applying Options.EmptyFields and Options.PreserveMarshalerFormat.
+func (d *Driver) marshal(buf *encodeBuffer, v interface{}) error {
+	if m, ok := v.(json.Marshaler); ok && d.preserveMarshalers {
+		if rv := reflect.ValueOf(v); rv.Kind() != reflect.Ptr || !rv.IsNil() {
+			b, err := m.MarshalJSON()
+			if err != nil {
+				return err
+			}
+			if !json.Valid(b) {
+				return fmt.Errorf("json: MarshalJSON for type %T returned invalid JSON", v)
+			}
+			buf.Write(b)
+			buf.WriteByte('\n')
+			return nil
+		}
+	}
+
+	if d.emptyFields != EmptyFieldsDefault {
+		v = applyEmptyFields(reflect.ValueOf(v), d.emptyFields)
+	}
+
+	return buf.enc.Encode(v)
+}
+
+// isNil reports whether v is nil or a nil pointer, map, slice, func or
+// channel, which would be stored as a null record or not at all.
+func isNil(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// objectField is one member of an object built by applyEmptyFields.
+type objectField struct {
+	name  string
+	value interface{}
+}
+
+// object is a JSON object that keeps its fields in struct declaration order.
+type object []objectField
+
+func (o object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		name, err := json.Marshal(field.name)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+
+		value, err := json.Marshal(field.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// applyEmptyFields rebuilds v with structs converted to objects whose empty
+// fields are included or omitted according to policy. Values with their own
+// MarshalJSON or MarshalText are left for encoding/json to handle.
+func applyEmptyFields(v reflect.Value, policy EmptyFieldPolicy) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+
+	if v.Type().Implements(marshalerType) || v.Type().Implements(textMarshalerType) {
+		return v.Interface()
+	}
+
+	if v.CanAddr() {
+		if pt := reflect.PtrTo(v.Type()); pt.Implements(marshalerType) || pt.Implements(textMarshalerType) {
+			return v.Addr().Interface()
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return applyEmptyFields(v.Elem(), policy)
+	case reflect.Struct:
+		return structObject(v, policy)
+	case reflect.Map:
+		if v.IsNil() || v.Type().Key().Kind() != reflect.String {
+			return v.Interface()
+		}
+		m := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			m[iter.Key().String()] = applyEmptyFields(iter.Value(), policy)
+		}
+		return m
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() || v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Interface()
+		}
+		s := make([]interface{}, v.Len())
+		for i := range s {
+			s[i] = applyEmptyFields(v.Index(i), policy)
+		}
+		return s
+	}
+	return v.Interface()
+}
+
+func structObject(v reflect.Value, policy EmptyFieldPolicy) object {
+	var obj object
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+		fv := v.Field(i)
+
+		if sf.Anonymous && name == "" {
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				if fv.Kind() == reflect.Ptr {
+					if fv.IsNil() {
+						continue
+					}
+					fv = fv.Elem()
+				}
+				obj = append(obj, structObject(fv, policy)...)
+				continue
+			}
+		}
+
+		if !sf.IsExported() {
+			continue
+		}
+
+		if policy == EmptyFieldsOmit && isEmptyValue(fv) {
+			continue
+		}
+
+		if name == "" {
+			name = sf.Name
+		}
+
+		value := applyEmptyFields(fv, policy)
+		if hasOption(opts, "string") && isScalar(fv) {
+			if b, err := json.Marshal(value); err == nil {
+				value = string(b)
+			}
+		}
+		obj = append(obj, objectField{name: name, value: value})
+	}
+	return obj
+}
+
+func hasOption(opts, option string) bool {
+	for _, opt := range strings.Split(opts, ",") {
+		if opt == option {
+			return true
+		}
+	}
+	return false
+}
+
+func isScalar(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// isEmptyValue mirrors encoding/json's definition of empty for omitempty.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestWriteRejectsNilValues(t *testing.T) {
+	db := newTestDriver(t, nil)
+
+	var user *User
+	var m map[string]int
+	var s []int
+	var f func()
+	var c chan int
+	for name, v := range map[string]interface{}{
+		"nil":         nil,
+		"nil pointer": user,
+		"nil map":     m,
+		"nil slice":   s,
+		"nil func":    f,
+		"nil chan":    c,
+	} {
+		if err := db.Write("things", "x", v); !errors.Is(err, ErrNilValue) {
+			t.Errorf("Write(%s) = %v, want ErrNilValue", name, err)
+		}
+	}
+
+	if _, err := os.Stat(db.recordPath("things", "x")); !os.IsNotExist(err) {
+		t.Errorf("rejected nil value was stored: %v", err)
+	}
+
+	john := benchUser
+	if err := db.Write("users", "john", &john); err != nil {
+		t.Errorf("Write(pointer to a User) = %v", err)
+	}
+	var got User
+	if err := db.Read("users", "john", &got); err != nil || got != benchUser {
+		t.Errorf("Read = %+v, %v, want %+v", got, err, benchUser)
+	}
+	if err := db.Write("things", "empty", map[string]int{}); err != nil {
+		t.Errorf("Write(empty map) = %v", err)
+	}
+	if err := db.Write("things", "zero", []int{}); err != nil {
+		t.Errorf("Write(empty slice) = %v", err)
+	}
+}
+
+func TestWriteAllowNull(t *testing.T) {
+	db := newTestDriver(t, &Options{AllowNull: true})
+
+	var m map[string]int
+	if err := db.Write("things", "x", m); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(db.recordPath("things", "x"))
+	if err != nil || string(b) != "null\n" {
+		t.Fatalf("stored %q, %v; want null", b, err)
+	}
+}
+
+type taggedUser struct {
+	Name  string `json:"name"`
+	Age   int    `json:"age,omitempty"`
+	Email string `json:"email"`
+}
+
+// storedFields decodes a stored record into its top-level fields.
+func storedFields(t *testing.T, db *Driver, collection, resource string) map[string]interface{} {
+	t.Helper()
+	b, err := os.ReadFile(db.recordPath(collection, resource))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		t.Fatal(err)
+	}
+	return fields
+}
+
+func TestEmptyFields(t *testing.T) {
+	for _, tc := range []struct {
+		policy      EmptyFieldPolicy
+		age, email  bool
+		userAge     bool
+		userPinCode bool
+	}{
+		{EmptyFieldsDefault, false, true, true, true},
+		{EmptyFieldsInclude, true, true, true, true},
+		{EmptyFieldsOmit, false, false, false, false},
+	} {
+		db := newTestDriver(t, &Options{EmptyFields: tc.policy})
+		if err := db.Write("tagged", "jane", taggedUser{Name: "jane"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Write("users", "john", User{Name: "john", Address: Address{City: "Paris"}}); err != nil {
+			t.Fatal(err)
+		}
+
+		fields := storedFields(t, db, "tagged", "jane")
+		if _, ok := fields["age"]; ok != tc.age {
+			t.Errorf("policy %d: age stored %v, want %v", tc.policy, ok, tc.age)
+		}
+		if _, ok := fields["email"]; ok != tc.email {
+			t.Errorf("policy %d: email stored %v, want %v", tc.policy, ok, tc.email)
+		}
+
+		fields = storedFields(t, db, "users", "john")
+		if _, ok := fields["Age"]; ok != tc.userAge {
+			t.Errorf("policy %d: zero Age stored %v, want %v", tc.policy, ok, tc.userAge)
+		}
+		address, _ := fields["Address"].(map[string]interface{})
+		if _, ok := address["PinCode"]; ok != tc.userPinCode {
+			t.Errorf("policy %d: zero Address.PinCode stored %v, want %v", tc.policy, ok, tc.userPinCode)
+		}
+		if fields["Name"] != "john" || address["City"] != "Paris" {
+			t.Errorf("policy %d: stored %v", tc.policy, fields)
+		}
+	}
+}
+
+// celsius marshals compactly as {"c":<value>}.
+type celsius float64
+
+func (c celsius) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf(`{"c":%g}`, float64(c))), nil
+}
+
+func (c *celsius) UnmarshalJSON(b []byte) error {
+	var v struct{ C float64 }
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*c = celsius(v.C)
+	return nil
+}
+
+func TestWriteHonorsMarshalJSON(t *testing.T) {
+	for _, preserve := range []bool{false, true} {
+		db := newTestDriver(t, &Options{PreserveMarshalerFormat: preserve})
+		if err := db.Write("temps", "today", celsius(21.5)); err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := os.ReadFile(db.recordPath("temps", "today"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "{\n\t\"c\": 21.5\n}\n"
+		if preserve {
+			want = "{\"c\":21.5}\n"
+		}
+		if string(b) != want {
+			t.Errorf("PreserveMarshalerFormat %v: stored %q, want %q", preserve, b, want)
+		}
+
+		var c celsius
+		if err := db.Read("temps", "today", &c); err != nil || c != 21.5 {
+			t.Errorf("PreserveMarshalerFormat %v: Read = %v, %v", preserve, c, err)
+		}
+	}
+}
+
+func TestWriteHonorsNestedMarshalJSON(t *testing.T) {
+	db := newTestDriver(t, &Options{PreserveMarshalerFormat: true})
+	reading := struct {
+		City string
+		Temp celsius
+	}{"Paris", 12}
+	if err := db.Write("readings", "paris", reading); err != nil {
+		t.Fatal(err)
+	}
+
+	var got struct {
+		City string
+		Temp celsius
+	}
+	if err := db.Read("readings", "paris", &got); err != nil || got != reading {
+		t.Fatalf("Read = %+v, %v, want %+v", got, err, reading)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	// ErrMissingCollection is returned when an empty collection name is
+	// passed to a method that needs one.
+	ErrMissingCollection = errors.New("Missing collection- no collection name given")
+
+	// ErrMissingResource is returned when an empty resource name is passed
+	// to a method that needs one.
+	ErrMissingResource = errors.New("Missing resource- no name for the record")
+
+	// ErrNotFound is returned when a record does not exist.
+	ErrNotFound = errors.New("Record not found")
+
+	// ErrTruncated is returned when a record's content does not match the
+	// length recorded in its header.
+	ErrTruncated = errors.New("Truncated record- content length does not match header")
+
+	// ErrRootMismatch is returned by VerifyMerkleRoot when a collection has
+	// changed since its root was recorded.
+	ErrRootMismatch = errors.New("Merkle root mismatch- collection has been modified")
+
+	// ErrTooManyCollections is returned by Write when creating a collection
+	// would exceed Options.MaxCollections.
+	ErrTooManyCollections = errors.New("Too many collections- limit reached")
+
+	// ErrFrozen is returned for operations on a collection frozen with
+	// FreezeCollection.
+	ErrFrozen = errors.New("Collection frozen- operation not allowed")
+
+	// ErrNoModifiedIndex is returned by ModifiedSince unless
+	// Options.ModifiedIndex is set.
+	ErrNoModifiedIndex = errors.New("Modified index disabled- set Options.ModifiedIndex")
+
+	// ErrReadOnly is returned for mutations of a collection marked with
+	// SetCollectionReadOnly.
+	ErrReadOnly = errors.New("Collection read-only- operation not allowed")
+
+	// ErrImmutable is returned for updates and deletes in a collection
+	// marked with SetCollectionImmutable, and for privileged calls made
+	// without force.
+	ErrImmutable = errors.New("Collection immutable- records can only be added")
+
+	// ErrNilValue is returned by Write for a nil value, or a nil pointer,
+	// map, slice, func or channel, unless Options.AllowNull is set.
+	ErrNilValue = errors.New("Nil value- refusing to store a null record")
+
+	// ErrMissingAttachment is returned when an empty attachment name is
+	// passed to a method that needs one.
+	ErrMissingAttachment = errors.New("Missing attachment- no attachment name given")
+
+	// ErrAttachmentTooLarge is returned by PutAttachment for content over
+	// Options.MaxAttachmentSize.
+	ErrAttachmentTooLarge = errors.New("Attachment too large- size limit exceeded")
+
+	// ErrZeroVariance is returned by Correlation when a field has the same
+	// value in every record, or fewer than two records have both fields.
+	ErrZeroVariance = errors.New("Zero variance- correlation undefined")
+
+	// ErrAlreadyOpen is returned by New with Options.ErrorIfOpen for a
+	// directory already open in this process, through any path to it.
+	ErrAlreadyOpen = errors.New("Database already open- directory in use by this process")
+
+	// ErrVersionConflict is returned by EventStore.Append when a stream is
+	// not at the version the caller expected.
+	ErrVersionConflict = errors.New("Version conflict- stream changed since it was read")
+)
+
+// ErrMissingField is returned by Write when a record lacks a field set with
+// SetRequiredFields, or has it set to null.
+type ErrMissingField struct {
+	Field string
+}
+
+func (e ErrMissingField) Error() string {
+	return "Missing field- required field " + e.Field + " is absent or null"
+}
+
+// Is makes errors.Is(err, ErrMissingField{}) match a missing field of any
+// name, and errors.Is(err, ErrMissingField{Field: f}) only f.
+func (e ErrMissingField) Is(target error) bool {
+	t, ok := target.(ErrMissingField)
+	return ok && (t.Field == "" || t.Field == e.Field)
+}
+
+// DecodeError is returned when a stored record is not valid JSON or does not
+// fit the value it is decoded into. Offset is the byte offset of the error
+// within the record's JSON, or -1 if unknown, and Excerpt the bytes around it.
+type DecodeError struct {
+	Collection string
+	Resource   string
+	Path       string
+	Offset     int64
+	Excerpt    string
+	Err        error
+}
+
+func (e *DecodeError) Error() string {
+	if e.Offset < 0 {
+		return fmt.Sprintf("Unable to decode %s/%s (%s): %v", e.Collection, e.Resource, e.Path, e.Err)
+	}
+	return fmt.Sprintf("Unable to decode %s/%s (%s) at offset %d near %q: %v",
+		e.Collection, e.Resource, e.Path, e.Offset, e.Excerpt, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error { return e.Err }
+
+// excerptRadius is how many bytes either side of the offset an excerpt keeps.
+const excerptRadius = 16
+
+// decodeError wraps err, returned while decoding b, as a *DecodeError for the
+// record it was read from.
+func (d *Driver) decodeError(collection, resource string, b []byte, err error) error {
+	e := &DecodeError{Collection: collection, Resource: resource, Offset: -1, Err: err}
+	if c, r, terr := d.transformKeys(collection, resource); terr == nil {
+		e.Path = d.recordPath(c, r)
+	}
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		e.Offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		e.Offset = typeErr.Offset
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		e.Offset = int64(len(b))
+	}
+
+	if e.Offset >= 0 {
+		from, to := e.Offset-excerptRadius, e.Offset+excerptRadius
+		if from < 0 {
+			from = 0
+		}
+		if to > int64(len(b)) {
+			to = int64(len(b))
+		}
+		if from < to {
+			e.Excerpt = string(b[from:to])
+		}
+	}
+	return e
+}
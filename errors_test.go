@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMissingNameSentinels(t *testing.T) {
+	db := newTestDriver(t, nil)
+
+	for _, tc := range []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"Write without collection", db.Write("", "john", benchUser), ErrMissingCollection},
+		{"Write without resource", db.Write("users", "", benchUser), ErrMissingResource},
+		{"Read without collection", db.Read("", "john", &User{}), ErrMissingCollection},
+		{"Read without resource", db.Read("users", "", &User{}), ErrMissingResource},
+		{"Delete without collection", db.Delete("", "john"), ErrMissingCollection},
+	} {
+		if !errors.Is(tc.err, tc.want) {
+			t.Errorf("%s = %v, want %v", tc.name, tc.err, tc.want)
+		}
+	}
+
+	if _, err := db.ReadAll(""); !errors.Is(err, ErrMissingCollection) {
+		t.Errorf("ReadAll without collection = %v, want ErrMissingCollection", err)
+	}
+}
+
+func TestMissingNameMessages(t *testing.T) {
+	db := newTestDriver(t, nil)
+
+	// Read used to report "no place to save record".
+	if err := db.Read("", "john", &User{}); err.Error() != ErrMissingCollection.Error() {
+		t.Fatalf("Read without collection reports %q", err)
+	}
+}
+
+// corruptOne writes ten records and replaces the fifth with content.
+func corruptOne(t *testing.T, db *Driver, content string) string {
+	t.Helper()
+	for i := 0; i < 10; i++ {
+		db.Write("users", fmt.Sprint("user", i), benchUser)
+	}
+	path := db.recordPath("users", "user4")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func expectDecodeError(t *testing.T, err error, path string, offset int64, excerpt string) {
+	t.Helper()
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("err = %v, want a *DecodeError", err)
+	}
+	if decodeErr.Collection != "users" || decodeErr.Resource != "user4" || decodeErr.Path != path {
+		t.Fatalf("DecodeError points at %s/%s (%s), want users/user4 (%s)",
+			decodeErr.Collection, decodeErr.Resource, decodeErr.Path, path)
+	}
+	if decodeErr.Offset != offset || !strings.Contains(decodeErr.Excerpt, excerpt) {
+		t.Fatalf("DecodeError at offset %d near %q, want %d near %q", decodeErr.Offset, decodeErr.Excerpt, offset, excerpt)
+	}
+}
+
+func TestDecodeErrorPinpointsRecord(t *testing.T) {
+	db := newTestDriver(t, nil)
+	path := corruptOne(t, db, `{"Name": "john", "Age" 25}`)
+
+	expectDecodeError(t, db.Read("users", "user4", &User{}), path, 24, `"Age" 25`)
+
+	_, err := db.GroupBy("users", "Name")
+	expectDecodeError(t, err, path, 24, `"Age" 25`)
+
+	_, err = db.CountWhere("users", func(raw json.RawMessage) (bool, error) {
+		var user User
+		return true, json.Unmarshal(raw, &user)
+	})
+	if err == nil {
+		t.Fatal("CountWhere over a malformed record succeeded")
+	}
+
+	report, err := db.Analyze("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Malformed.Count != 1 || len(report.DecodeErrors) != 1 {
+		t.Fatalf("Analyze found %d malformed records, want 1", report.Malformed.Count)
+	}
+	expectDecodeError(t, report.DecodeErrors[0], path, 24, `"Age" 25`)
+}
+
+func TestDecodeErrorTypeMismatch(t *testing.T) {
+	db := newTestDriver(t, nil)
+	path := corruptOne(t, db, `{"Name": ["john"]}`)
+
+	err := db.Read("users", "user4", &User{})
+	expectDecodeError(t, err, path, 10, `["john"]`)
+
+	var typeErr *json.UnmarshalTypeError
+	if !errors.As(err, &typeErr) {
+		t.Fatalf("DecodeError does not unwrap to the json error: %v", err)
+	}
+}
+
+func TestDecodeErrorTruncatedRecord(t *testing.T) {
+	db := newTestDriver(t, nil)
+	path := corruptOne(t, db, `{"Name": "jo`)
+
+	expectDecodeError(t, db.Read("users", "user4", &User{}), path, 12, `"jo`)
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// An event store keeps one stream per aggregate, one file per event, in a
+// collection named after the store:
+//
+//	orders/order-17/0000000001.json
+//
+// Every event also gets a store-wide sequence number from NextSequence, so
+// projections can follow all streams in order.
+const eventVersionDigits = 10
+
+// Snapshots of aggregate state are kept apart from the streams, one per
+// aggregate and store:
+//
+//	_snapshots/orders/order-17.json
+const snapshotsCollection = "_snapshots"
+
+// Event is a stored event. Data is the event as appended.
+type Event struct {
+	AggregateID string          `json:"aggregateId"`
+	Version     int             `json:"version"`
+	Seq         int64           `json:"seq"`
+	Time        time.Time       `json:"time"`
+	Data        json.RawMessage `json:"data"`
+}
+
+type eventSnapshot struct {
+	AggregateID string          `json:"aggregateId"`
+	Version     int             `json:"version"`
+	Time        time.Time       `json:"time"`
+	State       json.RawMessage `json:"state"`
+}
+
+// EventStore appends and loads the event streams of aggregates.
+type EventStore struct {
+	d          *Driver
+	collection string
+}
+
+// NewEventStore returns the event store kept in the named collection.
+func (d *Driver) NewEventStore(name string) (*EventStore, error) {
+	collection, _, err := d.transformKeys(name, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if collection == "" {
+		return nil, ErrMissingCollection
+	}
+
+	return &EventStore{d: d, collection: collection}, nil
+}
+
+// Append adds events to the end of an aggregate's stream, numbering them
+// from one past its current version. expectedVersion is the version the
+// caller last saw, 0 for a new stream; if another writer got there first
+// Append fails with ErrVersionConflict and writes nothing. Events are
+// written one file at a time, so a crash can leave a prefix of them.
+func (es *EventStore) Append(aggregateID string, events []interface{}, expectedVersion int) error {
+	if err := validAggregateID(aggregateID); err != nil {
+		return err
+	}
+
+	d := es.d
+	mutex, err := d.lockWritable(es.collection)
+	if err != nil {
+		return err
+	}
+	defer mutex.Unlock()
+
+	versions, err := es.versions(aggregateID)
+	if err != nil {
+		return err
+	}
+
+	if len(versions) != expectedVersion {
+		return fmt.Errorf("%s/%s at version %d, expected %d: %w", es.collection, aggregateID, len(versions), expectedVersion, ErrVersionConflict)
+	}
+
+	// Encode everything first so a bad event writes nothing.
+	data := make([]json.RawMessage, len(events))
+	for i, event := range events {
+		if data[i], err = json.Marshal(event); err != nil {
+			return err
+		}
+	}
+
+	for i, b := range data {
+		seq, err := d.NextSequence(es.sequenceName())
+		if err != nil {
+			return err
+		}
+
+		version := expectedVersion + i + 1
+		envelope, err := json.MarshalIndent(Event{
+			AggregateID: aggregateID,
+			Version:     version,
+			Seq:         int64(seq),
+			Time:        time.Now().UTC(),
+			Data:        b,
+		}, "", "\t")
+		if err != nil {
+			return err
+		}
+
+		if err := d.write(es.collection, eventResource(aggregateID, version), append(envelope, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Load returns the events of an aggregate's stream from fromVersion on,
+// oldest first. Versions start at 1.
+func (es *EventStore) Load(aggregateID string, fromVersion int) ([][]byte, error) {
+	if err := validAggregateID(aggregateID); err != nil {
+		return nil, err
+	}
+
+	if err := es.d.checkFrozen(es.collection); err != nil {
+		return nil, err
+	}
+
+	versions, err := es.versions(aggregateID)
+	if err != nil {
+		return nil, err
+	}
+
+	var events [][]byte
+	for _, version := range versions {
+		if version < fromVersion {
+			continue
+		}
+
+		event, err := es.read(aggregateID, version)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event.Data)
+	}
+	return events, nil
+}
+
+// LoadAll streams every event of every stream with a sequence number of
+// at least fromGlobalSeq on the first channel, in sequence order. Only the
+// next event of each stream is held in memory: streams are in sequence
+// order already, so they are merged as they are read. Once the scan ends
+// the event channel is closed and the error channel yields the error that
+// stopped it, if any, and is closed. Cancelling ctx stops the scan with
+// ctx.Err(), so a caller that stops reading early must cancel it.
+func (es *EventStore) LoadAll(ctx context.Context, fromGlobalSeq int64) (<-chan Event, <-chan error) {
+	events := make(chan Event)
+	errc := make(chan error, 1)
+
+	go func() {
+		defer close(errc)
+		defer close(events)
+
+		if err := es.loadAll(ctx, fromGlobalSeq, events); err != nil {
+			errc <- err
+		}
+	}()
+
+	return events, errc
+}
+
+func (es *EventStore) loadAll(ctx context.Context, fromGlobalSeq int64, events chan<- Event) error {
+	if err := es.d.checkFrozen(es.collection); err != nil {
+		return err
+	}
+
+	files, err := ioutil.ReadDir(filepath.Join(es.d.dir, es.collection))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var streams eventCursors
+	for _, file := range files {
+		if !file.IsDir() || validAggregateID(file.Name()) != nil {
+			continue
+		}
+
+		versions, err := es.versions(file.Name())
+		if err != nil {
+			return err
+		}
+
+		c := &eventCursor{aggregateID: file.Name(), versions: versions}
+		ok, err := es.advance(c, fromGlobalSeq)
+		if err != nil {
+			return err
+		}
+		if ok {
+			streams = append(streams, c)
+		}
+	}
+	heap.Init(&streams)
+
+	for len(streams) > 0 {
+		c := streams[0]
+		select {
+		case events <- c.next:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		ok, err := es.advance(c, fromGlobalSeq)
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Fix(&streams, 0)
+		} else {
+			heap.Pop(&streams)
+		}
+	}
+	return nil
+}
+
+// advance reads the next event of a stream at or after fromGlobalSeq into
+// c.next, reporting false once the stream is exhausted.
+func (es *EventStore) advance(c *eventCursor, fromGlobalSeq int64) (bool, error) {
+	for len(c.versions) > 0 {
+		event, err := es.read(c.aggregateID, c.versions[0])
+		if err != nil {
+			return false, err
+		}
+		c.versions = c.versions[1:]
+
+		if event.Seq >= fromGlobalSeq {
+			c.next = event
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// eventCursor is a stream being merged by LoadAll: its next event and the
+// versions after it.
+type eventCursor struct {
+	aggregateID string
+	versions    []int
+	next        Event
+}
+
+// eventCursors is a heap of streams by the sequence number of their next
+// event.
+type eventCursors []*eventCursor
+
+func (h eventCursors) Len() int            { return len(h) }
+func (h eventCursors) Less(i, j int) bool  { return h[i].next.Seq < h[j].next.Seq }
+func (h eventCursors) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *eventCursors) Push(x interface{}) { *h = append(*h, x.(*eventCursor)) }
+
+func (h *eventCursors) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// SaveSnapshot stores state as the state of an aggregate after the event at
+// version, replacing any earlier snapshot. The stream must already have
+// reached version. The store and _snapshots are both locked, in name order,
+// and either being frozen or read-only fails the call.
+func (es *EventStore) SaveSnapshot(aggregateID string, version int, state interface{}) error {
+	if err := validAggregateID(aggregateID); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	d := es.d
+	unlock, err := d.lockCollections(map[string]bool{es.collection: false, snapshotsCollection: false})
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	resource := es.snapshotResource(aggregateID)
+	if err := d.checkInsert(snapshotsCollection, d.recordPath(snapshotsCollection, resource)); err != nil {
+		return err
+	}
+
+	versions, err := es.versions(aggregateID)
+	if err != nil {
+		return err
+	}
+
+	if version < 1 || version > len(versions) {
+		return fmt.Errorf("Invalid snapshot- %s/%s has no version %d", es.collection, aggregateID, version)
+	}
+
+	snapshot, err := json.MarshalIndent(eventSnapshot{
+		AggregateID: aggregateID,
+		Version:     version,
+		Time:        time.Now().UTC(),
+		State:       b,
+	}, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return d.write(snapshotsCollection, resource, append(snapshot, '\n'))
+}
+
+// LoadWithSnapshot returns the latest snapshot of an aggregate and the
+// version its remaining events start at, for Load. Without a snapshot,
+// state is nil and fromVersion is 1, the whole stream.
+//
+//	state, from, err := orders.LoadWithSnapshot("order-17")
+//	events, err := orders.Load("order-17", from)
+func (es *EventStore) LoadWithSnapshot(aggregateID string) (state []byte, fromVersion int, err error) {
+	if err := validAggregateID(aggregateID); err != nil {
+		return nil, 0, err
+	}
+
+	for _, collection := range []string{es.collection, snapshotsCollection} {
+		if err := es.d.checkFrozen(collection); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	resource := es.snapshotResource(aggregateID)
+	b, err := es.d.readFile(es.d.recordPath(snapshotsCollection, resource))
+	if os.IsNotExist(err) {
+		return nil, 1, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var snapshot eventSnapshot
+	if err := json.Unmarshal(b, &snapshot); err != nil {
+		return nil, 0, es.d.decodeError(snapshotsCollection, resource, b, err)
+	}
+	return snapshot.State, snapshot.Version + 1, nil
+}
+
+// versions lists the versions stored for an aggregate, ascending.
+func (es *EventStore) versions(aggregateID string) ([]int, error) {
+	dir := filepath.Join(es.d.dir, es.collection, aggregateID)
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []int
+	for _, file := range files {
+		name, ok := es.d.recordName(dir, file)
+		if !ok {
+			continue
+		}
+		if version, err := strconv.Atoi(name); err == nil && len(name) == eventVersionDigits {
+			versions = append(versions, version)
+		}
+	}
+	sort.Ints(versions)
+	return versions, nil
+}
+
+func (es *EventStore) read(aggregateID string, version int) (Event, error) {
+	resource := eventResource(aggregateID, version)
+	b, err := es.d.readFile(es.d.recordPath(es.collection, resource))
+	if err != nil {
+		return Event{}, err
+	}
+
+	var event Event
+	if err := json.Unmarshal(b, &event); err != nil {
+		return Event{}, es.d.decodeError(es.collection, resource, b, err)
+	}
+	return event, nil
+}
+
+func (es *EventStore) snapshotResource(aggregateID string) string {
+	return es.collection + "/" + aggregateID
+}
+
+func (es *EventStore) sequenceName() string {
+	return "eventstore-" + es.collection
+}
+
+func eventResource(aggregateID string, version int) string {
+	return fmt.Sprintf("%s/%0*d", aggregateID, eventVersionDigits, version)
+}
+
+func validAggregateID(id string) error {
+	if id == "" || strings.HasPrefix(id, ".") || strings.ContainsAny(id, `/\`) {
+		return fmt.Errorf("Invalid aggregate- %q is not a valid aggregate ID", id)
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestEventStoreLoadAllAbandonedEarly(t *testing.T) {
+	db := newTestDriver(t, nil)
+	es, err := db.NewEventStore("orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := es.Append("o1", []interface{}{1, 2, 3}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 10; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		events, errc := es.LoadAll(ctx, 0)
+		<-events
+		cancel()
+		if err := <-errc; !errors.Is(err, context.Canceled) {
+			t.Fatalf("abandoned LoadAll = %v, want context.Canceled", err)
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Fatalf("%d goroutines left behind by abandoned LoadAll calls", n-before)
+	}
+}
+
+func TestEventStoreAppendConflict(t *testing.T) {
+	db := newTestDriver(t, nil)
+	es, _ := db.NewEventStore("orders")
+
+	if err := es.Append("o1", []interface{}{"placed"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := es.Append("o1", []interface{}{"paid"}, 0); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("stale Append = %v, want ErrVersionConflict", err)
+	}
+
+	events, err := es.Load("o1", 1)
+	if err != nil || len(events) != 1 || string(events[0]) != `"placed"` {
+		t.Fatalf("Load = %q, %v", events, err)
+	}
+}
+
+// loadAll collects what LoadAll streams as aggregate ID and data pairs.
+func loadAll(t *testing.T, es *EventStore, fromGlobalSeq int64) []string {
+	t.Helper()
+	events, errc := es.LoadAll(context.Background(), fromGlobalSeq)
+	var got []string
+	for e := range events {
+		got = append(got, e.AggregateID+string(e.Data))
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestEventStoreLoadAllOrder(t *testing.T) {
+	db := newTestDriver(t, nil)
+	es, _ := db.NewEventStore("orders")
+	es.Append("b", []interface{}{1}, 0)
+	es.Append("a", []interface{}{2}, 0)
+	es.Append("b", []interface{}{3}, 1)
+
+	if got := loadAll(t, es, 2); !reflect.DeepEqual(got, []string{"a2", "b3"}) {
+		t.Fatalf("LoadAll(2) = %v, want [a2 b3]", got)
+	}
+}
+
+func TestEventStoreLoadAllMergesStreams(t *testing.T) {
+	db := newTestDriver(t, nil)
+	es, _ := db.NewEventStore("orders")
+
+	var want []string
+	versions := make(map[string]int)
+	for i := 0; i < 30; i++ {
+		id := []string{"a", "b", "c"}[(i/2+i*i)%3]
+		if err := es.Append(id, []interface{}{i}, versions[id]); err != nil {
+			t.Fatal(err)
+		}
+		versions[id]++
+		want = append(want, fmt.Sprintf("%s%d", id, i))
+	}
+
+	if got := loadAll(t, es, 0); !reflect.DeepEqual(got, want) {
+		t.Fatalf("LoadAll = %v, want %v", got, want)
+	}
+	if got := loadAll(t, es, 100); len(got) != 0 {
+		t.Fatalf("LoadAll past the end = %v", got)
+	}
+}
+
+func TestEventStoreLoadAllFrozen(t *testing.T) {
+	db := newTestDriver(t, nil)
+	es, _ := db.NewEventStore("orders")
+	es.Append("a", []interface{}{1}, 0)
+
+	unfreeze, err := db.FreezeCollection("orders", FreezeAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unfreeze()
+
+	events, errc := es.LoadAll(context.Background(), 0)
+	for range events {
+		t.Fatal("LoadAll sent an event from a frozen store")
+	}
+	if err := <-errc; !errors.Is(err, ErrFrozen) {
+		t.Fatalf("LoadAll = %v, want ErrFrozen", err)
+	}
+}
+
+func TestEventStoreSnapshots(t *testing.T) {
+	db := newTestDriver(t, nil)
+	es, _ := db.NewEventStore("orders")
+
+	state, from, err := es.LoadWithSnapshot("o1")
+	if err != nil || state != nil || from != 1 {
+		t.Fatalf("LoadWithSnapshot without snapshot = %q, %d, %v", state, from, err)
+	}
+
+	es.Append("o1", []interface{}{1, 2, 3}, 0)
+	if err := es.SaveSnapshot("o1", 4, "ahead"); err == nil {
+		t.Fatal("SaveSnapshot past the stream succeeded")
+	}
+	if err := es.SaveSnapshot("o1", 2, map[string]int{"total": 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	state, from, err = es.LoadWithSnapshot("o1")
+	if err != nil || from != 3 {
+		t.Fatalf("LoadWithSnapshot = %d, %v", from, err)
+	}
+	var total struct{ Total int }
+	if err := json.Unmarshal(state, &total); err != nil || total.Total != 3 {
+		t.Fatalf("snapshot state = %s, %v", state, err)
+	}
+
+	events, err := es.Load("o1", from)
+	if err != nil || len(events) != 1 || string(events[0]) != "3" {
+		t.Fatalf("events after snapshot = %q, %v", events, err)
+	}
+}
+
+func TestEventStoreSnapshotHonorsReadOnly(t *testing.T) {
+	db := newTestDriver(t, nil)
+	es, _ := db.NewEventStore("orders")
+	es.Append("o1", []interface{}{1}, 0)
+
+	if err := db.SetCollectionReadOnly(snapshotsCollection, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := es.SaveSnapshot("o1", 1, "state"); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("SaveSnapshot into read-only _snapshots = %v, want ErrReadOnly", err)
+	}
+}
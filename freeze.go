@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// FreezeMode selects which operations FreezeCollection blocks.
+type FreezeMode int
+
+const (
+	// FreezeWrites blocks mutations but still allows reads.
+	FreezeWrites FreezeMode = iota + 1
+	// FreezeAll blocks reads as well as mutations.
+	FreezeAll
+)
+
+func (m FreezeMode) String() string {
+	switch m {
+	case FreezeWrites:
+		return "writes"
+	case FreezeAll:
+		return "all"
+	}
+	return fmt.Sprintf("FreezeMode(%d)", int(m))
+}
+
+type freeze struct {
+	mode     FreezeMode
+	released chan struct{}
+	once     sync.Once
+}
+
+func (f *freeze) release() {
+	f.once.Do(func() { close(f.released) })
+}
+
+// FreezeCollection blocks operations on a collection, e.g. for a maintenance
+// window, until the returned unfreeze func is called or the driver is
+// closed. Blocked operations fail with ErrFrozen, after waiting up to
+// Options.FreezeWait for the freeze to lift. Mutations already in progress
+// complete before FreezeCollection returns.
+func (d *Driver) FreezeCollection(collection string, mode FreezeMode) (unfreeze func(), err error) {
+	if collection, _, err = d.transformKeys(collection, ""); err != nil {
+		return nil, err
+	}
+
+	if collection == "" {
+		return nil, ErrMissingCollection
+	}
+
+	if mode != FreezeWrites && mode != FreezeAll {
+		return nil, fmt.Errorf("Invalid freeze mode- %v", mode)
+	}
+
+	f := &freeze{mode: mode, released: make(chan struct{})}
+
+	d.freezeMutex.Lock()
+	if _, ok := d.freezes[collection]; ok {
+		d.freezeMutex.Unlock()
+		return nil, fmt.Errorf("%s: %w", collection, ErrFrozen)
+	}
+	d.freezes[collection] = f
+	d.freezeMutex.Unlock()
+
+	// Wait out any mutation that acquired the lock before the freeze.
+	mutex := d.getOrCreateMutex(collection)
+	mutex.Lock()
+	mutex.Unlock()
+
+	return func() {
+		d.freezeMutex.Lock()
+		if d.freezes[collection] == f {
+			delete(d.freezes, collection)
+		}
+		d.freezeMutex.Unlock()
+		f.release()
+	}, nil
+}
+
+// FrozenCollections returns the currently frozen collections and their modes.
+func (d *Driver) FrozenCollections() map[string]FreezeMode {
+	d.freezeMutex.Lock()
+	defer d.freezeMutex.Unlock()
+
+	frozen := make(map[string]FreezeMode, len(d.freezes))
+	for collection, f := range d.freezes {
+		frozen[collection] = f.mode
+	}
+	return frozen
+}
+
+// lockCollection acquires the collection mutex for a mutation, waiting for
+// or failing on a freeze. The freeze is checked again once the lock is held
+// so a mutation can't slip in between the check and the lock.
+func (d *Driver) lockCollection(collection string) (*sync.Mutex, error) {
+	return d.lockFreezable(collection, true)
+}
+
+// lockForRead acquires the collection mutex for a read that must not
+// overlap any mutation. Only FreezeAll blocks it.
+func (d *Driver) lockForRead(collection string) (*sync.Mutex, error) {
+	return d.lockFreezable(collection, false)
+}
+
+func (d *Driver) lockFreezable(collection string, write bool) (*sync.Mutex, error) {
+	mutex := d.getOrCreateMutex(collection)
+	deadline := time.Now().Add(d.freezeWait)
+
+	for {
+		if err := d.waitFrozen(collection, write, deadline); err != nil {
+			return nil, err
+		}
+
+		mutex.Lock()
+		if d.frozen(collection, write) == nil {
+			return mutex, nil
+		}
+		mutex.Unlock()
+	}
+}
+
+// checkFrozen fails reads of a collection frozen with FreezeAll.
+func (d *Driver) checkFrozen(collection string) error {
+	return d.waitFrozen(collection, false, time.Now().Add(d.freezeWait))
+}
+
+func (d *Driver) waitFrozen(collection string, write bool, deadline time.Time) error {
+	for {
+		f := d.frozen(collection, write)
+		if f == nil {
+			return nil
+		}
+
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return fmt.Errorf("%s: %w", collection, ErrFrozen)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-f.released:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// frozen returns the freeze blocking an operation, if any.
+func (d *Driver) frozen(collection string, write bool) *freeze {
+	d.freezeMutex.Lock()
+	defer d.freezeMutex.Unlock()
+
+	f, ok := d.freezes[collection]
+	if !ok || !write && f.mode == FreezeWrites {
+		return nil
+	}
+	return f
+}
+
+// releaseFreezes lifts every freeze so none can outlive the driver.
+func (d *Driver) releaseFreezes() {
+	d.freezeMutex.Lock()
+	freezes := d.freezes
+	d.freezes = make(map[string]*freeze)
+	d.freezeMutex.Unlock()
+
+	for _, f := range freezes {
+		f.release()
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// scheduleSync marks paths as needing an fsync and arms the debounce timer.
+// It is a no-op unless Options.SyncInterval is set.
+func (d *Driver) scheduleSync(paths ...string) {
+	if d.syncInterval <= 0 {
+		return
+	}
+
+	d.syncMutex.Lock()
+	defer d.syncMutex.Unlock()
+
+	for _, path := range paths {
+		d.dirty[path] = struct{}{}
+	}
+
+	if d.syncTimer == nil {
+		d.syncTimer = time.AfterFunc(d.syncInterval, func() {
+			if err := d.Sync(); err != nil {
+				d.logger.Error("Unable to sync database %s: %v", d.dir, err)
+			}
+		})
+	}
+}
+
+// Sync fsyncs every file and directory touched since the last sync.
+func (d *Driver) Sync() error {
+	d.syncMutex.Lock()
+	dirty := d.dirty
+	d.dirty = make(map[string]struct{})
+	if d.syncTimer != nil {
+		d.syncTimer.Stop()
+		d.syncTimer = nil
+	}
+	d.syncMutex.Unlock()
+
+	var firstErr error
+	for path := range dirty {
+		if err := fsync(path); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func fsync(path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return f.Sync()
+}
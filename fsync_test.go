@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// pendingSyncs is how many fsyncs the next Sync will make.
+func pendingSyncs(d *Driver) int {
+	d.syncMutex.Lock()
+	defer d.syncMutex.Unlock()
+	return len(d.dirty)
+}
+
+func TestSyncIntervalBatchesBursts(t *testing.T) {
+	db := newTestDriver(t, &Options{SyncInterval: time.Hour})
+
+	const writes = 100
+	for i := 0; i < writes; i++ {
+		user := benchUser
+		user.Age = json.Number(fmt.Sprint(i))
+		if err := db.Write("users", "john", user); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The record file and its directory, rather than two per write.
+	if n := pendingSyncs(db); n != 2 {
+		t.Fatalf("%d fsyncs pending after a burst of %d writes, want 2", n, writes)
+	}
+
+	var user User
+	if err := db.Read("users", "john", &user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Age != json.Number(fmt.Sprint(writes-1)) {
+		t.Fatalf("Age = %s, want the last write's %d", user.Age, writes-1)
+	}
+
+	if err := db.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if n := pendingSyncs(db); n != 0 {
+		t.Fatalf("%d fsyncs pending after Sync, want 0", n)
+	}
+}
+
+func TestSyncIntervalTimerSyncs(t *testing.T) {
+	db := newTestDriver(t, &Options{SyncInterval: 10 * time.Millisecond})
+	db.Write("users", "john", benchUser)
+
+	deadline := time.Now().Add(time.Second)
+	for pendingSyncs(db) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("debounced sync never ran")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestCloseSyncs(t *testing.T) {
+	db := newTestDriver(t, &Options{SyncInterval: time.Hour})
+	db.Write("users", "john", benchUser)
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := pendingSyncs(db); n != 0 {
+		t.Fatalf("%d fsyncs pending after Close, want 0", n)
+	}
+}
+
+func TestNoSyncIntervalSchedulesNothing(t *testing.T) {
+	db := newTestDriver(t, nil)
+	db.Write("users", "john", benchUser)
+
+	if n := pendingSyncs(db); n != 0 {
+		t.Fatalf("%d fsyncs pending without SyncInterval, want 0", n)
+	}
+}
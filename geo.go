@@ -0,0 +1,399 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// geoCellDegrees is the side of a GeoIndex grid cell.
+	geoCellDegrees = 1.0
+	earthRadiusKm  = 6371.0
+)
+
+type geoCell struct{ lat, lon int }
+
+type geoPoint struct {
+	resource string
+	lat, lon float64
+}
+
+// GeoIndex is an in-memory grid of the records of a collection by location.
+// It is kept up to date by writes and deletes made through the driver.
+type GeoIndex struct {
+	d          *Driver
+	collection string
+	latField   string
+	lonField   string
+
+	mutex  sync.RWMutex
+	points map[string]geoPoint
+	cells  map[geoCell][]string
+}
+
+// CreateGeoIndex indexes the records of a collection by the numeric fields at
+// latField and lonField, dotted paths as in GroupBy. Records without a valid
+// latitude and longitude are left out.
+func (d *Driver) CreateGeoIndex(collection, latField, lonField string) (*GeoIndex, error) {
+	collection, _, err := d.transformKeys(collection, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if collection == "" {
+		return nil, ErrMissingCollection
+	}
+
+	idx := &GeoIndex{d: d, collection: collection, latField: latField, lonField: lonField}
+	// Writes wait on the collection mutex until the index is registered,
+	// so none lands between the scan and addIndex unindexed.
+	mutex, err := d.lockForRead(collection)
+	if err != nil {
+		return nil, err
+	}
+	defer mutex.Unlock()
+
+	if err := idx.rebuild(); err != nil {
+		return nil, err
+	}
+
+	d.addIndex(collection, idx)
+	return idx, nil
+}
+
+// NearestN returns up to n resources closest to lat, lon by great-circle
+// distance, nearest first. Cells are searched in rings around the query
+// until no unsearched cell can hold anything nearer than the n-th record
+// found, which takes more rings close to the poles.
+func (idx *GeoIndex) NearestN(lat, lon float64, n int) ([]string, error) {
+	if !validLatLon(lat, lon) {
+		return nil, fmt.Errorf("Invalid coordinates- %v, %v", lat, lon)
+	}
+
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+
+	if n <= 0 || len(idx.points) == 0 {
+		return nil, nil
+	}
+
+	type candidate struct {
+		resource string
+		distance float64
+	}
+
+	center := cellOf(lat, lon)
+	visited := make(map[geoCell]bool)
+	var candidates []candidate
+	var distances []float64
+	for r := 0; r <= maxGeoRing && len(candidates) < len(idx.points); r++ {
+		for _, cell := range ringCells(center, r) {
+			if visited[cell] {
+				continue
+			}
+			visited[cell] = true
+
+			for _, resource := range idx.cells[cell] {
+				p := idx.points[resource]
+				d := haversine(lat, lon, p.lat, p.lon)
+				candidates = append(candidates, candidate{resource, d})
+				distances = append(distances, d)
+			}
+		}
+
+		if len(distances) >= n {
+			sort.Float64s(distances)
+			if distances[n-1] <= geoRingBound(center, lat, r) {
+				break
+			}
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].resource < candidates[j].resource
+	})
+
+	if len(candidates) > n {
+		candidates = candidates[:n]
+	}
+
+	resources := make([]string, len(candidates))
+	for i, c := range candidates {
+		resources[i] = c.resource
+	}
+	return resources, nil
+}
+
+// Rebuild reindexes every record of the collection from disk, e.g. after
+// records were changed by another process.
+func (idx *GeoIndex) Rebuild() error {
+	mutex, err := idx.d.lockCollection(idx.collection)
+	if err != nil {
+		return err
+	}
+	defer mutex.Unlock()
+
+	return idx.rebuild()
+}
+
+// rebuild reindexes every record of the collection.
+func (idx *GeoIndex) rebuild() error {
+	points := make(map[string]geoPoint)
+	err := idx.d.forEachFile(idx.collection, func(resource string, b []byte) error {
+		if p, ok := idx.locate(resource, b); ok {
+			points[resource] = p
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+
+	idx.points = make(map[string]geoPoint, len(points))
+	idx.cells = make(map[geoCell][]string)
+	for _, p := range points {
+		idx.insert(p)
+	}
+	return nil
+}
+
+// update reindexes one record; b is nil if it was deleted.
+func (idx *GeoIndex) update(resource string, b []byte) {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+
+	idx.remove(resource)
+	if b == nil {
+		return
+	}
+	if p, ok := idx.locate(resource, b); ok {
+		idx.insert(p)
+	}
+}
+
+func (idx *GeoIndex) locate(resource string, b []byte) (geoPoint, bool) {
+	doc, err := idx.d.indexDocument(idx.collection, b)
+	if err != nil {
+		return geoPoint{}, false
+	}
+
+	lat, ok := numberField(doc, idx.latField)
+	if !ok {
+		return geoPoint{}, false
+	}
+	lon, ok := numberField(doc, idx.lonField)
+	if !ok || !validLatLon(lat, lon) {
+		return geoPoint{}, false
+	}
+	return geoPoint{resource: resource, lat: lat, lon: lon}, true
+}
+
+func (idx *GeoIndex) insert(p geoPoint) {
+	idx.points[p.resource] = p
+	cell := cellOf(p.lat, p.lon)
+	idx.cells[cell] = append(idx.cells[cell], p.resource)
+}
+
+func (idx *GeoIndex) remove(resource string) {
+	p, ok := idx.points[resource]
+	if !ok {
+		return
+	}
+	delete(idx.points, resource)
+
+	cell := cellOf(p.lat, p.lon)
+	resources := idx.cells[cell]
+	for i, r := range resources {
+		if r == resource {
+			resources = append(resources[:i], resources[i+1:]...)
+			break
+		}
+	}
+	if len(resources) == 0 {
+		delete(idx.cells, cell)
+	} else {
+		idx.cells[cell] = resources
+	}
+}
+
+type geoFeature struct {
+	Type       string      `json:"type"`
+	ID         string      `json:"id"`
+	Geometry   geoGeometry `json:"geometry"`
+	Properties interface{} `json:"properties"`
+}
+
+type geoGeometry struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+// ExportGeoJSON writes the records of a collection to w as a GeoJSON
+// FeatureCollection. Each record with a valid latitude and longitude at
+// latField and lonField, dotted paths as in GroupBy, becomes a Point feature
+// whose id is the resource name and whose properties are the remaining
+// fields. Other records are skipped. Features are written as they are read,
+// so the collection is never held in memory.
+func (d *Driver) ExportGeoJSON(collection, latField, lonField string, w io.Writer) error {
+	collection, _, err := d.transformKeys(collection, "")
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, `{"type":"FeatureCollection","features":[`); err != nil {
+		return err
+	}
+
+	first := true
+	err = d.forEachRecord(collection, func(resource string, b []byte) error {
+		doc, err := decodeDocument(b)
+		if err != nil {
+			return d.decodeError(collection, resource, b, err)
+		}
+
+		lat, ok := numberField(doc, latField)
+		if !ok {
+			return nil
+		}
+		lon, ok := numberField(doc, lonField)
+		if !ok || !validLatLon(lat, lon) {
+			return nil
+		}
+
+		removeField(doc, latField)
+		removeField(doc, lonField)
+		feature, err := json.Marshal(geoFeature{
+			Type:       "Feature",
+			ID:         resource,
+			Geometry:   geoGeometry{Type: "Point", Coordinates: [2]float64{lon, lat}},
+			Properties: doc,
+		})
+		if err != nil {
+			return err
+		}
+
+		if !first {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		first = false
+
+		_, err = w.Write(feature)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "]}\n")
+	return err
+}
+
+// removeField deletes the field at a dotted path from a decoded document.
+func removeField(doc interface{}, path string) {
+	parent := doc
+	if i := strings.LastIndexByte(path, '.'); i >= 0 {
+		parent, _ = lookupField(doc, path[:i])
+		path = path[i+1:]
+	}
+	if obj, ok := parent.(map[string]interface{}); ok {
+		delete(obj, path)
+	}
+}
+
+// numberField returns the JSON number at path as a float64.
+func numberField(doc interface{}, path string) (float64, bool) {
+	value, _ := lookupField(doc, path)
+	n, ok := value.(json.Number)
+	if !ok {
+		return 0, false
+	}
+	f, err := n.Float64()
+	return f, err == nil
+}
+
+func validLatLon(lat, lon float64) bool {
+	return lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180
+}
+
+var (
+	geoLatCells = int(math.Ceil(180 / geoCellDegrees))
+	geoLonCells = int(math.Ceil(360 / geoCellDegrees))
+	maxGeoRing  = geoLonCells / 2
+)
+
+func cellOf(lat, lon float64) geoCell {
+	row := int(math.Floor((lat + 90) / geoCellDegrees))
+	if row >= geoLatCells {
+		row = geoLatCells - 1
+	}
+	col := int(math.Floor((lon + 180) / geoCellDegrees))
+	return geoCell{row, col % geoLonCells}
+}
+
+// geoRingBound is a lower bound, in kilometres, on the distance from lat to
+// any point outside the cells within r rings of center. Leaving by row
+// means crossing at least r cells of latitude. Leaving by column means
+// reaching a meridian at least r cells of longitude away, and the nearest
+// such meridian is at most the cross-track distance.
+func geoRingBound(center geoCell, lat float64, r int) float64 {
+	step := float64(r) * geoCellDegrees * math.Pi / 180
+
+	bound := math.Inf(1)
+	if center.lat-r > 0 || center.lat+r < geoLatCells-1 {
+		bound = step
+	}
+	if 2*r+1 < geoLonCells {
+		cross := math.Asin(math.Cos(lat*math.Pi/180) * math.Sin(math.Min(step, math.Pi/2)))
+		bound = math.Min(bound, cross)
+	}
+	return bound * earthRadiusKm
+}
+
+// ringCells returns the cells at Chebyshev distance r from center, with
+// longitude wrapping around the antimeridian. Cells may repeat once the ring
+// wraps all the way round.
+func ringCells(center geoCell, r int) []geoCell {
+	if r == 0 {
+		return []geoCell{center}
+	}
+
+	var cells []geoCell
+	add := func(row, col int) {
+		if row >= 0 && row < geoLatCells {
+			cells = append(cells, geoCell{row, ((col % geoLonCells) + geoLonCells) % geoLonCells})
+		}
+	}
+
+	for i := -r; i <= r; i++ {
+		add(center.lat-r, center.lon+i)
+		add(center.lat+r, center.lon+i)
+		add(center.lat+i, center.lon-r)
+		add(center.lat+i, center.lon+r)
+	}
+	return cells
+}
+
+// haversine returns the great-circle distance in kilometres between two
+// points given in degrees.
+func haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	rlat1, rlat2 := lat1*math.Pi/180, lat2*math.Pi/180
+	dlat := rlat2 - rlat1
+	dlon := (lon2 - lon1) * math.Pi / 180
+
+	a := math.Sin(dlat/2)*math.Sin(dlat/2) + math.Cos(rlat1)*math.Cos(rlat2)*math.Sin(dlon/2)*math.Sin(dlon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestCreateGeoIndexDuringWrites(t *testing.T) {
+	db := newTestDriver(t, nil)
+	for i := 0; i < 50; i++ {
+		db.Write("places", fmt.Sprintf("p%03d", i), map[string]float64{"lat": 0.1, "lon": 0.1})
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 50; i < 200; i++ {
+			db.Write("places", fmt.Sprintf("p%03d", i), map[string]float64{"lat": 0.2, "lon": 0.2})
+		}
+	}()
+
+	idx, err := db.CreateGeoIndex("places", "lat", "lon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+
+	got, err := idx.NearestN(0, 0, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 200 {
+		t.Fatalf("NearestN found %d records, want all 200", len(got))
+	}
+}
@@ -2,4 +2,4 @@ module golang-database
 
 go 1.25.0
 
-require github.com/jcelliott/lumber v0.0.0-20160324203708-dd349441af25 // indirect
+require github.com/jcelliott/lumber v0.0.0-20160324203708-dd349441af25
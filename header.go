@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+)
+
+// Length headers look like "#123\n". A JSON document can never start with
+// '#', so headered and plain records can live side by side.
+const lengthHeaderPrefix = '#'
+
+func addLengthHeader(b []byte) []byte {
+	header := "#" + strconv.Itoa(len(b)) + "\n"
+	return append([]byte(header), b...)
+}
+
+// readFile reads a record file and returns its content with any length
+// header verified and stripped.
+func (d *Driver) readFile(path string) ([]byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return stripLengthHeader(path, b)
+}
+
+// stripLengthHeader verifies and removes the length header of the content b
+// of the file at path, if it has one.
+func stripLengthHeader(path string, b []byte) ([]byte, error) {
+	if len(b) == 0 || b[0] != lengthHeaderPrefix {
+		return b, nil
+	}
+
+	i := bytes.IndexByte(b, '\n')
+	if i < 0 {
+		return nil, fmt.Errorf("%s: %w", path, ErrTruncated)
+	}
+
+	n, err := strconv.Atoi(string(b[1:i]))
+	if err != nil {
+		return nil, fmt.Errorf("Corrupt record- %s has an invalid length header", path)
+	}
+
+	if content := b[i+1:]; len(content) == n {
+		return content, nil
+	}
+	return nil, fmt.Errorf("%s: %w", path, ErrTruncated)
+}
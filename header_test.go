@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestLengthHeaderDetectsTruncation(t *testing.T) {
+	db := newTestDriver(t, &Options{LengthHeader: true})
+	if err := db.Write("users", "john", benchUser); err != nil {
+		t.Fatal(err)
+	}
+
+	var user User
+	if err := db.Read("users", "john", &user); err != nil || user.Name != "john" {
+		t.Fatalf("Read = %+v, %v", user, err)
+	}
+
+	path := db.recordPath("users", "john")
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path, fi.Size()-5); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Read("users", "john", &user); !errors.Is(err, ErrTruncated) {
+		t.Fatalf("Read of truncated record = %v, want ErrTruncated", err)
+	}
+}
+
+func TestLengthHeaderDetectsTruncatedHeader(t *testing.T) {
+	db := newTestDriver(t, &Options{LengthHeader: true})
+	db.Write("users", "john", benchUser)
+
+	if err := os.Truncate(db.recordPath("users", "john"), 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Read("users", "john", &User{}); !errors.Is(err, ErrTruncated) {
+		t.Fatalf("Read of record cut inside its header = %v, want ErrTruncated", err)
+	}
+}
+
+func TestLengthHeaderReadsPlainRecords(t *testing.T) {
+	dir := t.TempDir()
+	db, err := New(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Write("users", "john", benchUser)
+	db.Close()
+
+	db, err = New(dir, &Options{LengthHeader: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var user User
+	if err := db.Read("users", "john", &user); err != nil || user.Name != "john" {
+		t.Fatalf("Read of a record without header = %+v, %v", user, err)
+	}
+}
+
+func TestStripLengthHeader(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+		ok       bool
+	}{
+		{"#2\n{}", "{}", true},
+		{"{}", "{}", true},
+		{"#3\n{}", "", false},
+		{"#1\n{}", "", false},
+		{"#2", "", false},
+	} {
+		got, err := stripLengthHeader("r.json", []byte(tc.in))
+		if (err == nil) != tc.ok || string(got) != tc.want {
+			t.Errorf("stripLengthHeader(%q) = %q, %v, want %q, ok %v", tc.in, got, err, tc.want, tc.ok)
+		}
+	}
+}
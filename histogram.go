@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// HistogramBucket counts the records whose value falls in [RangeMin,
+// RangeMax), or [RangeMin, RangeMax] for the last bucket. For string fields
+// the range is a position in the alphabet, see Histogram, and Low and High
+// are the first and last values counted in the bucket.
+type HistogramBucket struct {
+	RangeMin float64
+	RangeMax float64
+	Count    int
+
+	Low  string
+	High string
+}
+
+// Histogram splits the range of the field at fieldPath across a collection
+// into buckets equal-width intervals and counts the records in each. Numeric
+// fields are bucketed by value. String fields are bucketed alphabetically:
+// after dropping the prefix the smallest and largest values share, each
+// string is placed by its leading bytes read as a fraction between 0 and 1,
+// which becomes its RangeMin and RangeMax. Records where the field is
+// missing or neither a number nor a string are skipped; a field holding both
+// fails. A collection with no values gives no buckets.
+func (d *Driver) Histogram(collection, fieldPath string, buckets int) ([]HistogramBucket, error) {
+	collection, _, err := d.transformKeys(collection, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if buckets <= 0 {
+		return nil, fmt.Errorf("Invalid bucket count- %d", buckets)
+	}
+
+	var numbers []float64
+	var strs []string
+	err = d.forEachRecord(collection, func(resource string, b []byte) error {
+		doc, err := decodeDocument(b)
+		if err != nil {
+			return d.decodeError(collection, resource, b, err)
+		}
+
+		value, _ := lookupField(doc, fieldPath)
+		switch v := value.(type) {
+		case json.Number:
+			if f, err := v.Float64(); err == nil {
+				numbers = append(numbers, f)
+			}
+		case string:
+			strs = append(strs, v)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(numbers) > 0 && len(strs) > 0 {
+		return nil, fmt.Errorf("Unable to compute histogram- %s in %s holds both numbers and strings", fieldPath, collection)
+	}
+
+	if len(strs) > 0 {
+		return stringHistogram(strs, buckets), nil
+	}
+	if len(numbers) > 0 {
+		return numberHistogram(numbers, buckets), nil
+	}
+	return nil, nil
+}
+
+// histogramBuckets returns buckets equal-width buckets spanning values, and
+// the bucket each value falls in.
+func histogramBuckets(values []float64, buckets int) ([]HistogramBucket, []int) {
+	min, max := values[0], values[0]
+	for _, f := range values {
+		min = math.Min(min, f)
+		max = math.Max(max, f)
+	}
+
+	width := (max - min) / float64(buckets)
+	hist := make([]HistogramBucket, buckets)
+	for i := range hist {
+		hist[i].RangeMin = min + float64(i)*width
+		hist[i].RangeMax = min + float64(i+1)*width
+	}
+	hist[buckets-1].RangeMax = max
+
+	index := make([]int, len(values))
+	for j, f := range values {
+		i := 0
+		if width > 0 {
+			i = int((f - min) / width)
+		}
+		if i >= buckets {
+			i = buckets - 1
+		}
+		hist[i].Count++
+		index[j] = i
+	}
+	return hist, index
+}
+
+func numberHistogram(values []float64, buckets int) []HistogramBucket {
+	hist, _ := histogramBuckets(values, buckets)
+	return hist
+}
+
+func stringHistogram(values []string, buckets int) []HistogramBucket {
+	sort.Strings(values)
+
+	first, last := values[0], values[len(values)-1]
+	prefix := 0
+	for prefix < len(first) && prefix < len(last) && first[prefix] == last[prefix] {
+		prefix++
+	}
+
+	positions := make([]float64, len(values))
+	for i, s := range values {
+		positions[i] = alphabetPosition(s[prefix:])
+	}
+
+	hist, index := histogramBuckets(positions, buckets)
+	for j := len(values) - 1; j >= 0; j-- {
+		hist[index[j]].Low = values[j]
+	}
+	for j, s := range values {
+		hist[index[j]].High = s
+	}
+	return hist
+}
+
+// alphabetPosition reads the first bytes of s as a base-256 fraction, so
+// that positions sort like the strings do, up to the precision of a
+// float64.
+func alphabetPosition(s string) float64 {
+	var position float64
+	scale := 1.0
+	for i := 0; i < len(s) && i < 7; i++ {
+		scale /= 256
+		position += float64(s[i]) * scale
+	}
+	return position
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestHistogramBuckets(t *testing.T) {
+	db := newTestDriver(t, nil)
+	for i := 0; i <= 8; i++ {
+		db.Write("items", fmt.Sprintf("n%d", i), map[string]int{"size": i})
+	}
+	// Records without a numeric size are skipped.
+	db.Write("items", "missing", map[string]int{"weight": 1})
+	db.Write("items", "null", map[string]interface{}{"size": nil})
+	db.Write("items", "bool", map[string]interface{}{"size": true})
+	db.Write("items", "list", []int{1, 2})
+
+	hist, err := db.Histogram("items", "size", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Width 2: each bucket is half-open except the last, which takes 8.
+	want := []HistogramBucket{
+		{RangeMin: 0, RangeMax: 2, Count: 2},
+		{RangeMin: 2, RangeMax: 4, Count: 2},
+		{RangeMin: 4, RangeMax: 6, Count: 2},
+		{RangeMin: 6, RangeMax: 8, Count: 3},
+	}
+	if len(hist) != len(want) {
+		t.Fatalf("Histogram = %+v, want %+v", hist, want)
+	}
+	for i := range want {
+		if hist[i] != want[i] {
+			t.Fatalf("bucket %d = %+v, want %+v", i, hist[i], want[i])
+		}
+	}
+}
+
+func TestHistogramConstantField(t *testing.T) {
+	db := newTestDriver(t, nil)
+	for i := 0; i < 3; i++ {
+		db.Write("items", fmt.Sprintf("n%d", i), map[string]int{"size": 5})
+	}
+
+	hist, err := db.Histogram("items", "size", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hist) != 3 || hist[0].Count != 3 || hist[0].RangeMin != 5 || hist[2].RangeMax != 5 {
+		t.Fatalf("Histogram = %+v, want every record in the first bucket", hist)
+	}
+}
+
+func TestHistogramStrings(t *testing.T) {
+	db := newTestDriver(t, nil)
+	for _, name := range []string{"apple", "avocado", "banana", "cherry", "cranberry"} {
+		db.Write("fruit", name, map[string]string{"name": name})
+	}
+
+	hist, err := db.Histogram("fruit", "name", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hist) != 2 {
+		t.Fatalf("Histogram = %+v, want 2 buckets", hist)
+	}
+	if hist[0].Low != "apple" || hist[0].High != "banana" || hist[0].Count != 3 {
+		t.Errorf("first bucket = %+v, want apple to banana", hist[0])
+	}
+	if hist[1].Low != "cherry" || hist[1].High != "cranberry" || hist[1].Count != 2 {
+		t.Errorf("last bucket = %+v, want cherry to cranberry", hist[1])
+	}
+}
+
+func TestHistogramErrors(t *testing.T) {
+	db := newTestDriver(t, nil)
+	db.Write("items", "none", map[string]int{"weight": 1})
+	if hist, err := db.Histogram("items", "size", 3); err != nil || hist != nil {
+		t.Fatalf("Histogram without values = %+v, %v", hist, err)
+	}
+
+	db.Write("items", "a", map[string]interface{}{"size": 1})
+	if _, err := db.Histogram("items", "size", 0); err == nil {
+		t.Error("Histogram accepted zero buckets")
+	}
+
+	db.Write("items", "b", map[string]interface{}{"size": "large"})
+	if _, err := db.Histogram("items", "size", 3); err == nil {
+		t.Error("Histogram accepted a field holding numbers and strings")
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// SetCollectionImmutable marks a collection as an append-only audit trail:
+// new records can be written and everything can be read, but overwriting or
+// deleting a record fails with ErrImmutable. The flag is sticky; setting it
+// is always allowed, but clearing it requires force. Both are logged as
+// administrative actions.
+func (d *Driver) SetCollectionImmutable(collection string, immutable, force bool) error {
+	collection, _, err := d.transformKeys(collection, "")
+	if err != nil {
+		return err
+	}
+
+	if collection == "" {
+		return ErrMissingCollection
+	}
+
+	mutex, err := d.lockCollection(collection)
+	if err != nil {
+		return err
+	}
+	defer mutex.Unlock()
+
+	manifest, err := d.loadManifest(collection)
+	if err != nil {
+		return err
+	}
+
+	if manifest.Immutable == immutable {
+		return nil
+	}
+
+	if !immutable && !force {
+		return fmt.Errorf("%s: clearing the flag requires force: %w", collection, ErrImmutable)
+	}
+
+	manifest.Immutable = immutable
+	if err := d.saveManifest(collection, manifest); err != nil {
+		return err
+	}
+
+	if immutable {
+		d.logger.Warn("Collection %s marked immutable", collection)
+	} else {
+		d.logger.Warn("Collection %s immutable flag cleared by force", collection)
+	}
+	return nil
+}
+
+// PurgeImmutable deletes the records of an immutable collection last
+// written before olderThan, for retention policies. Day directories of an
+// append-only collection are purged by key time as in PurgeBefore. It does
+// nothing without force, so routine code can't purge by accident, and every
+// purge is logged as an administrative action.
+func (d *Driver) PurgeImmutable(collection string, olderThan time.Time, force bool) error {
+	collection, _, err := d.transformKeys(collection, "")
+	if err != nil {
+		return err
+	}
+
+	if collection == "" {
+		return ErrMissingCollection
+	}
+
+	if !force {
+		return fmt.Errorf("%s: purging requires force: %w", collection, ErrImmutable)
+	}
+
+	mutex, err := d.lockWritable(collection)
+	if err != nil {
+		return err
+	}
+	defer mutex.Unlock()
+
+	dir := filepath.Join(d.dir, collection)
+	if _, err := stat(dir); err != nil {
+		return err
+	}
+
+	if err := d.purgeBefore(collection, olderThan); err != nil {
+		return err
+	}
+
+	purged := 0
+	for _, resource := range d.recordNames(dir) {
+		fi, err := os.Stat(d.recordPath(collection, resource))
+		if err != nil || !fi.ModTime().Before(olderThan) {
+			continue
+		}
+
+		before, tracked := d.previousVersion(collection, resource)
+		if err := os.RemoveAll(d.recordLocation(collection, resource)); err != nil {
+			return err
+		}
+		if err := d.removeAttachments(collection, resource); err != nil {
+			return err
+		}
+		d.recordModified(collection, resource, true)
+		d.recordChange(collection, resource, tracked, before, nil)
+		d.updateIndexes(collection, resource, nil)
+		purged++
+	}
+
+	d.logger.Warn("Collection %s purged of %d records written before %s", collection, purged, olderThan.UTC().Format(time.RFC3339))
+	d.scheduleSync(dir)
+	return nil
+}
+
+// lockMutable is lockWritable for mutations that change or remove existing
+// records, failing with ErrImmutable if the collection is immutable.
+func (d *Driver) lockMutable(collection string) (*sync.Mutex, error) {
+	mutex, err := d.lockWritable(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.immutable(collection) {
+		mutex.Unlock()
+		return nil, fmt.Errorf("%s: %w", collection, ErrImmutable)
+	}
+	return mutex, nil
+}
+
+// checkInsert fails with ErrImmutable if path, a record or attachment file,
+// exists in an immutable collection. Callers must hold the collection mutex.
+func (d *Driver) checkInsert(collection, path string) error {
+	if !d.immutable(collection) {
+		return nil
+	}
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s: %w", collection, ErrImmutable)
+	}
+	return nil
+}
+
+// immutable reports whether a collection is marked immutable.
+func (d *Driver) immutable(collection string) bool {
+	manifest, err := d.loadManifest(collection)
+	return err == nil && manifest.Immutable
+}
@@ -0,0 +1,60 @@
+package main
+
+// recordIndex is an in-memory index over the records of a collection, such
+// as a GeoIndex, kept current by the driver's own writes and deletes.
+type recordIndex interface {
+	// update reindexes one record; b is nil if it was deleted.
+	update(resource string, b []byte)
+	// rebuild reindexes every record of the collection.
+	rebuild() error
+}
+
+func (d *Driver) addIndex(collection string, idx recordIndex) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.indexes[collection] = append(d.indexes[collection], idx)
+}
+
+// updateIndexes keeps the indexes of a collection in step with a write, or
+// a delete when b is nil. An empty resource means the whole collection
+// changed. Callers must hold the collection mutex.
+func (d *Driver) updateIndexes(collection, resource string, b []byte) {
+	d.mutex.Lock()
+	indexes := d.indexes[collection]
+	d.mutex.Unlock()
+
+	for _, idx := range indexes {
+		if resource != "" {
+			idx.update(resource, b)
+			continue
+		}
+		if err := idx.rebuild(); err != nil {
+			d.logger.Warn("Unable to rebuild index of %s: %v", collection, err)
+		}
+	}
+}
+
+// waitIndexes waits for indexes updated in the background, such as
+// projectors, to catch up with the writes made so far.
+func (d *Driver) waitIndexes() {
+	d.mutex.Lock()
+	var indexes []recordIndex
+	for _, list := range d.indexes {
+		indexes = append(indexes, list...)
+	}
+	d.mutex.Unlock()
+
+	for _, idx := range indexes {
+		if w, ok := idx.(interface{ Wait() }); ok {
+			w.Wait()
+		}
+	}
+}
+
+// indexDocument decodes a record for indexing. Field aliases and casing are
+// applied as on read, but records are never migrated from here.
+func (d *Driver) indexDocument(collection string, b []byte) (interface{}, error) {
+	b, _ = renameFields(b, d.fieldAliases(collection))
+	return decodeDocument(d.normalizeFields(b))
+}
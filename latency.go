@@ -0,0 +1,132 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// latencyBounds are the upper bounds of the latency histogram buckets,
+// doubling from 100µs to about 3.3s. A last bucket counts anything slower.
+var latencyBounds = func() []time.Duration {
+	bounds := make([]time.Duration, 16)
+	for i := range bounds {
+		bounds[i] = 100 * time.Microsecond << uint(i)
+	}
+	return bounds
+}()
+
+// LatencyHistogram describes the latencies of one kind of operation.
+// Counts[i] is the number of operations that took at most Bounds[i] and
+// more than Bounds[i-1]; the extra last count holds the slower ones.
+// LockWait is the part of Total spent waiting for the collection lock, or
+// for a freeze to lift.
+type LatencyHistogram struct {
+	Bounds   []time.Duration
+	Counts   []uint64
+	Count    uint64
+	Total    time.Duration
+	LockWait time.Duration
+	Max      time.Duration
+}
+
+type latencies struct {
+	mutex sync.Mutex
+	ops   map[string]*LatencyHistogram
+}
+
+// LatencyStats returns a copy of the latency histogram of each operation
+// timed so far: "write", "read", "delete" and "readAll". It is empty unless
+// Options.LatencyHistograms is set.
+func (d *Driver) LatencyStats() map[string]LatencyHistogram {
+	d.latencies.mutex.Lock()
+	defer d.latencies.mutex.Unlock()
+
+	stats := make(map[string]LatencyHistogram, len(d.latencies.ops))
+	for op, h := range d.latencies.ops {
+		c := *h
+		c.Counts = append([]uint64(nil), h.Counts...)
+		stats[op] = c
+	}
+	return stats
+}
+
+// opTimer times one operation in two phases: waiting for the collection
+// lock, and everything after it, which is mostly I/O.
+type opTimer struct {
+	d          *Driver
+	op         string
+	collection string
+	resource   string
+	start      time.Time
+	acquired   time.Time
+	size       int
+}
+
+// startOp starts timing an operation, or returns nil, whose methods do
+// nothing, if neither histograms nor slow-operation logging are on.
+func (d *Driver) startOp(op, collection, resource string) *opTimer {
+	if !d.latencyHistograms && d.slowOpThreshold <= 0 {
+		return nil
+	}
+	return &opTimer{d: d, op: op, collection: collection, resource: resource, start: time.Now()}
+}
+
+// locked marks the end of the lock wait.
+func (t *opTimer) locked() {
+	if t != nil {
+		t.acquired = time.Now()
+	}
+}
+
+// moved notes that the operation read or wrote size bytes.
+func (t *opTimer) moved(size int) {
+	if t != nil {
+		t.size = size
+	}
+}
+
+// done records the operation, failed or not; callers defer it right after
+// startOp so that every return is timed.
+func (t *opTimer) done() {
+	if t == nil {
+		return
+	}
+
+	total := time.Since(t.start)
+	var wait time.Duration
+	if !t.acquired.IsZero() {
+		wait = t.acquired.Sub(t.start)
+	}
+
+	d := t.d
+	if d.latencyHistograms {
+		d.latencies.mutex.Lock()
+		h, ok := d.latencies.ops[t.op]
+		if !ok {
+			h = &LatencyHistogram{Bounds: latencyBounds, Counts: make([]uint64, len(latencyBounds)+1)}
+			d.latencies.ops[t.op] = h
+		}
+
+		i := 0
+		for i < len(latencyBounds) && total > latencyBounds[i] {
+			i++
+		}
+		h.Counts[i]++
+		h.Count++
+		h.Total += total
+		h.LockWait += wait
+		if total > h.Max {
+			h.Max = total
+		}
+		d.latencies.mutex.Unlock()
+	}
+
+	if d.slowOpThreshold > 0 && total > d.slowOpThreshold {
+		dominant := "I/O"
+		if wait > total-wait {
+			dominant = "lock wait"
+		}
+		d.logger.Warn("Slow %s of %s/%s: %v (lock wait %v, I/O %v, %d bytes), %s dominated",
+			t.op, t.collection, t.resource, total, wait, total-wait, t.size, dominant)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyStatsCountSuccesses(t *testing.T) {
+	db := newTestDriver(t, &Options{LatencyHistograms: true})
+	db.Write("users", "john", benchUser)
+	db.Read("users", "john", &User{})
+	db.ReadAll("users")
+	db.Delete("users", "john")
+
+	stats := db.LatencyStats()
+	for _, op := range []string{"write", "read", "readAll", "delete"} {
+		if stats[op].Count != 1 {
+			t.Fatalf("%s count = %d, want 1", op, stats[op].Count)
+		}
+	}
+}
+
+func TestLatencyStatsCountFailures(t *testing.T) {
+	db := newTestDriver(t, &Options{LatencyHistograms: true, FreezeWait: 10 * time.Millisecond})
+
+	// A value that fails validation.
+	if err := db.Write("users", "john", nil); err == nil {
+		t.Fatal("Write of nil succeeded")
+	}
+	if err := db.Read("users", "nobody", &User{}); err == nil {
+		t.Fatal("Read of a missing record succeeded")
+	}
+	if err := db.Delete("users", "nobody"); err == nil {
+		t.Fatal("Delete of a missing record succeeded")
+	}
+
+	// A write timing out on a freeze.
+	unfreeze, err := db.FreezeCollection("users", FreezeWrites)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Write("users", "john", benchUser); err == nil {
+		t.Fatal("Write under a freeze succeeded")
+	}
+	unfreeze()
+
+	stats := db.LatencyStats()
+	for op, want := range map[string]uint64{"write": 2, "read": 1, "delete": 1} {
+		if stats[op].Count != want {
+			t.Fatalf("%s count = %d, want %d", op, stats[op].Count, want)
+		}
+	}
+	if stats["write"].Total < 10*time.Millisecond {
+		t.Fatalf("write total %v misses the freeze wait", stats["write"].Total)
+	}
+}
@@ -1,12 +1,18 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"hash"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/jcelliott/lumber"
 )
@@ -23,16 +29,250 @@ type (
 		Trace(string, ...interface{})
 	}
 
+	// KeyedRecord is a record's raw JSON along with its resource name.
+	KeyedRecord struct {
+		Key  string
+		Data json.RawMessage
+	}
+
 	Driver struct {
 		mutex   sync.Mutex
 		mutexes map[string]*sync.Mutex
 		dir     string
 		logger  Logger
+
+		syncInterval time.Duration
+		syncMutex    sync.Mutex
+		syncTimer    *time.Timer
+		dirty        map[string]struct{}
+
+		aliases       map[string]map[string]string
+		transforms    map[string]*transform
+		migrateOnRead bool
+		keyFields     map[string]string
+		keyField      string
+
+		sequenceBatch uint64
+		sequences     map[string]*sequence
+
+		counterFlushInterval time.Duration
+		counterMutex         sync.Mutex
+		counterTimer         *time.Timer
+		counters             map[string]*Counter
+
+		lengthHeader bool
+		emptyFields  EmptyFieldPolicy
+
+		keyTransformer       func(string) string
+		transformCollections bool
+
+		recordDirs bool
+
+		maxCollections   int
+		collectionsMutex sync.Mutex
+
+		flexibleSchema bool
+		schemas        map[string]*inferredSchema
+
+		freezeWait  time.Duration
+		freezeMutex sync.Mutex
+		freezes     map[string]*freeze
+
+		required map[string][]string
+
+		preserveMarshalers bool
+
+		modifiedIndex bool
+		modIndexes    map[string]*modIndex
+
+		computedFields map[string]func(collection, resource string, data []byte) (interface{}, error)
+
+		manifests map[string]*collectionManifest
+
+		allowNull bool
+
+		scanConcurrency int
+
+		fieldCasing       FieldCasing
+		nestedFieldCasing bool
+
+		indexes map[string][]recordIndex
+
+		maxAttachmentSize int64
+
+		recompactPause time.Duration
+
+		recordOrder RecordOrder
+
+		trackChanges bool
+
+		hashFunc func() hash.Hash
+
+		openKey string
+
+		latencyHistograms bool
+		slowOpThreshold   time.Duration
+		latencies         latencies
+
+		onProgress       func(op string, done, total int64, currentKey string)
+		progressInterval time.Duration
+
+		appendMutex sync.Mutex
+		appendTime  uint64
+		appendHi    uint16
+		appendLo    uint64
 	}
 )
 
 type Options struct {
 	Logger
+
+	// LogLevel sets the level of the console logger created when Logger is
+	// nil: "TRACE", "DEBUG", "INFO", "WARN", "ERROR" or "FATAL". Defaults
+	// to "INFO".
+	LogLevel string
+
+	// SyncInterval enables debounced fsync. Writes are still renamed into
+	// place immediately, but the affected files and directories are only
+	// fsynced once per interval. Zero disables fsync entirely.
+	SyncInterval time.Duration
+
+	// MigrateOnRead rewrites records that still use a legacy field name
+	// registered with RegisterFieldAliases the first time they are read.
+	MigrateOnRead bool
+
+	// KeyFields maps a collection to the top-level field that holds each
+	// record's key. Write rejects records whose key field does not equal
+	// the resource name. Append and InsertContentAddressed, which choose
+	// the key themselves, are not checked.
+	KeyFields map[string]string
+
+	// KeyField is the key field of every collection not in KeyFields, e.g.
+	// "id". Write then rejects records that are not JSON objects, lack the
+	// field, or hold a different key in it.
+	KeyField string
+
+	// SequenceBatch is how many sequence values NextSequence reserves on
+	// disk at a time. Values reserved but not handed out before a crash are
+	// skipped, never reused. Defaults to 1.
+	SequenceBatch uint64
+
+	// CounterFlushInterval batches counter updates in memory and writes
+	// them this often, and in Close. Zero writes on every Add and Set.
+	CounterFlushInterval time.Duration
+
+	// LengthHeader prefixes every record file with its content length so
+	// Read can detect truncated files and return ErrTruncated. Records
+	// written without the header remain readable.
+	LengthHeader bool
+
+	// EmptyFields overrides the omitempty tags of written structs.
+	EmptyFields EmptyFieldPolicy
+
+	// KeyTransformer normalizes resource names, e.g. strings.ToLower, in
+	// Write, Read and Delete before any path is built. It must not return
+	// names containing path separators.
+	KeyTransformer func(string) string
+
+	// TransformCollections applies KeyTransformer to collection names too.
+	TransformCollections bool
+
+	// RecordDirs stores each record as a directory holding data.json, so
+	// sidecar metadata can be kept next to it with SetSidecar.
+	RecordDirs bool
+
+	// MaxCollections caps how many collections Write may create. Existing
+	// collection directories count towards the limit, except internal ones
+	// such as _changes whose names start with an underscore. Zero means
+	// unlimited.
+	MaxCollections int
+
+	// FlexibleSchema infers each collection's schema from the records
+	// written to it; see LockSchema.
+	FlexibleSchema bool
+
+	// FreezeWait is how long an operation on a frozen collection waits for
+	// the freeze to lift before failing with ErrFrozen. Zero fails at once.
+	FreezeWait time.Duration
+
+	// PreserveMarshalerFormat stores the output of values implementing
+	// json.Marshaler exactly as their MarshalJSON returns it, instead of
+	// re-indenting it like other records.
+	PreserveMarshalerFormat bool
+
+	// ModifiedIndex maintains a per-collection index of when each record
+	// was last written, for ModifiedSince.
+	ModifiedIndex bool
+
+	// ComputedFields maps a top-level field name to a function that derives
+	// its value, e.g. a checksum or created_at, from the marshaled record.
+	// Write sets each field before validating and storing the record, and
+	// aborts if any function returns an error.
+	ComputedFields map[string]func(collection, resource string, data []byte) (interface{}, error)
+
+	// AllowNull lets Write store a nil value, pointer, map or slice as a
+	// null record instead of failing with ErrNilValue.
+	AllowNull bool
+
+	// ScanConcurrency is how many record files ReadAll and other collection
+	// scans read in parallel. Results keep their usual order. Zero or one
+	// reads sequentially.
+	ScanConcurrency int
+
+	// FieldCasing rewrites top-level field names to one casing when records
+	// are written and read, so records from services using different
+	// conventions look alike to field paths, KeyFields and required fields.
+	// Struct decoding already matches names case-insensitively.
+	FieldCasing FieldCasing
+
+	// NestedFieldCasing applies FieldCasing to nested objects as well.
+	NestedFieldCasing bool
+
+	// MaxAttachmentSize caps the size in bytes of each attachment stored
+	// with PutAttachment. Zero means unlimited.
+	MaxAttachmentSize int64
+
+	// RecompactPause is how long Recompact sleeps after each record it
+	// rewrites, to limit its load on the disk.
+	RecompactPause time.Duration
+
+	// RecordOrder is the order ReadAll and other collection scans return
+	// records in. Defaults to sorted by name on every platform.
+	RecordOrder RecordOrder
+
+	// TrackChanges stores the field-by-field diff of every change to a
+	// record, whether by Write, Delete, Swap, a purge or any other call, in
+	// the _changes collection, for GetChangeLog.
+	TrackChanges bool
+
+	// ErrorIfOpen makes New fail with ErrAlreadyOpen for a directory this
+	// process already has open, rather than return the open driver, which
+	// keeps the options it was opened with.
+	ErrorIfOpen bool
+
+	// HashFunc is the hash InsertContentAddressed names records by.
+	// Defaults to SHA-256.
+	HashFunc func() hash.Hash
+
+	// LatencyHistograms records the latency of every Write, Read, Delete
+	// and ReadAll for LatencyStats, failed ones included.
+	LatencyHistograms bool
+
+	// SlowOpThreshold logs, at Warn, every operation timed as for
+	// LatencyHistograms that takes longer, with how much of it was spent
+	// waiting for the collection lock. Zero disables the log.
+	SlowOpThreshold time.Duration
+
+	// OnProgress is called during Recompact and Projector.Replay with the
+	// operation name, the records handled so far, the total or -1 if it
+	// isn't known up front, and the last record handled. It is called at
+	// most once per ProgressInterval, plus once when the operation ends,
+	// successfully or not.
+	OnProgress func(op string, done, total int64, currentKey string)
+
+	// ProgressInterval is the least time between OnProgress calls.
+	// Defaults to one second.
+	ProgressInterval time.Duration
 }
 
 func New(dir string, options *Options) (*Driver, error) {
@@ -43,125 +283,717 @@ func New(dir string, options *Options) (*Driver, error) {
 	}
 
 	if opts.Logger == nil {
-		opts.Logger = lumber.NewConsoleLogger(lumber.INFO)
+		level := lumber.INFO
+		if opts.LogLevel != "" {
+			level = lumber.LvlInt(opts.LogLevel)
+			if strings.TrimSpace(lumber.LvlStr(level)) != strings.ToUpper(opts.LogLevel) {
+				return nil, fmt.Errorf("Invalid log level- %q", opts.LogLevel)
+			}
+		}
+		opts.Logger = lumber.NewConsoleLogger(level)
+	}
+
+	if opts.SequenceBatch == 0 {
+		opts.SequenceBatch = 1
+	}
+
+	if opts.HashFunc == nil {
+		opts.HashFunc = sha256.New
+	}
+
+	if opts.ProgressInterval <= 0 {
+		opts.ProgressInterval = time.Second
 	}
 
 	driver := Driver{
-		dir:     dir,
-		logger:  opts.Logger,
-		mutexes: make(map[string]*sync.Mutex),
+		dir:           dir,
+		logger:        opts.Logger,
+		mutexes:       make(map[string]*sync.Mutex),
+		syncInterval:  opts.SyncInterval,
+		dirty:         make(map[string]struct{}),
+		aliases:       make(map[string]map[string]string),
+		transforms:    make(map[string]*transform),
+		migrateOnRead: opts.MigrateOnRead,
+		keyFields:     opts.KeyFields,
+		keyField:      opts.KeyField,
+		sequenceBatch: opts.SequenceBatch,
+		sequences:     make(map[string]*sequence),
+		lengthHeader:  opts.LengthHeader,
+		emptyFields:   opts.EmptyFields,
+
+		keyTransformer:       opts.KeyTransformer,
+		transformCollections: opts.TransformCollections,
+		recordDirs:           opts.RecordDirs,
+		maxCollections:       opts.MaxCollections,
+		flexibleSchema:       opts.FlexibleSchema,
+		schemas:              make(map[string]*inferredSchema),
+		freezeWait:           opts.FreezeWait,
+		freezes:              make(map[string]*freeze),
+		required:             make(map[string][]string),
+		preserveMarshalers:   opts.PreserveMarshalerFormat,
+		modifiedIndex:        opts.ModifiedIndex,
+		modIndexes:           make(map[string]*modIndex),
+		computedFields:       opts.ComputedFields,
+		manifests:            make(map[string]*collectionManifest),
+		allowNull:            opts.AllowNull,
+		scanConcurrency:      opts.ScanConcurrency,
+		fieldCasing:          opts.FieldCasing,
+		nestedFieldCasing:    opts.NestedFieldCasing,
+		indexes:              make(map[string][]recordIndex),
+		maxAttachmentSize:    opts.MaxAttachmentSize,
+		recompactPause:       opts.RecompactPause,
+		recordOrder:          opts.RecordOrder,
+		trackChanges:         opts.TrackChanges,
+		hashFunc:             opts.HashFunc,
+		latencyHistograms:    opts.LatencyHistograms,
+		slowOpThreshold:      opts.SlowOpThreshold,
+		latencies:            latencies{ops: make(map[string]*LatencyHistogram)},
+		counterFlushInterval: opts.CounterFlushInterval,
+		counters:             make(map[string]*Counter),
+		onProgress:           opts.OnProgress,
+		progressInterval:     opts.ProgressInterval,
 	}
 
-	if _, err := os.Stat(dir); err == nil {
+	openMutex.Lock()
+	defer openMutex.Unlock()
+
+	_, err := os.Stat(dir)
+	exists := err == nil
+	if exists {
 		opts.Logger.Debug("Database %s already exists", dir)
-		return &driver, nil
+	} else {
+		opts.Logger.Debug("Creating Database %s", dir)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return &driver, err
+		}
+	}
+
+	d, err := driver.register(opts.ErrorIfOpen)
+	if err != nil || d != &driver {
+		return d, err
 	}
 
-	opts.Logger.Debug("Creating Database %s", dir)
-	return &driver, os.MkdirAll(dir, 0755)
+	if exists {
+		return d, d.recoverSwaps()
+	}
+	return d, nil
+}
+
+// Close flushes and syncs the database and releases its directory, so New
+// opens it afresh. A driver New returned again for an already open
+// directory is the same driver, closed for every caller at once.
+func (d *Driver) Close() error {
+	d.unregister()
+	d.releaseFreezes()
+	d.waitIndexes()
+	err := d.FlushCounters()
+	if serr := d.Sync(); err == nil {
+		err = serr
+	}
+	return err
 }
 
 func (d *Driver) Write(collection, resource string, v interface{}) error {
+	collection, resource, err := d.transformKeys(collection, resource)
+	if err != nil {
+		return err
+	}
+
 	if collection == "" {
-		return fmt.Errorf("Missing collection- no place to save record")
+		return ErrMissingCollection
 	}
 
 	if resource == "" {
-		return fmt.Errorf("Missing resource- no name for the record")
+		return ErrMissingResource
+	}
+
+	if reservedResources[resource] {
+		return fmt.Errorf("Invalid resource- %q is reserved", resource)
 	}
 
-	mutex := d.getOrCreateMutex(collection)
-	mutex.Lock()
+	op := d.startOp("write", collection, resource)
+	defer op.done()
+	mutex, err := d.lockWritable(collection)
+	if err != nil {
+		return err
+	}
 	defer mutex.Unlock()
+	op.locked()
 
-	dir := filepath.Join(d.dir, collection)
-	fnlPath := filepath.Join(dir, resource+".json")
-	tempPath := fnlPath + ".tmp"
+	if err := d.checkInsert(collection, d.recordPath(collection, resource)); err != nil {
+		return err
+	}
 
-	if err := os.MkdirAll(dir, 0755); err != nil {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	b, err := d.encode(buf, collection, resource, v)
+	if err != nil {
+		return err
+	}
+
+	if err := d.writeRecord(collection, resource, b); err != nil {
+		return err
+	}
+	op.moved(len(b))
+	return nil
+}
+
+// encode marshals v into the on-disk record format and runs the write-time
+// checks configured for the collection. The result may alias buf.
+func (d *Driver) encode(buf *encodeBuffer, collection, resource string, v interface{}) ([]byte, error) {
+	if err := d.marshalValue(buf, collection, v); err != nil {
+		return nil, err
+	}
+	return d.prepare(collection, resource, buf.Bytes())
+}
+
+// marshalValue marshals v into buf after the nil check and the collection's
+// encode hook.
+func (d *Driver) marshalValue(buf *encodeBuffer, collection string, v interface{}) error {
+	if !d.allowNull && isNil(v) {
+		return ErrNilValue
+	}
+
+	v, err := d.encodeValue(collection, v)
+	if err != nil {
 		return err
 	}
+	return d.marshal(buf, v)
+}
 
-	b, err := json.MarshalIndent(v, "", "\t")
+// prepare runs the write-time transforms and checks on a marshaled record.
+func (d *Driver) prepare(collection, resource string, data []byte) ([]byte, error) {
+	return d.prepareRecord(collection, resource, data, true)
+}
+
+// prepareGenerated is prepare for a record stored under a key the driver
+// chose, as by Append and InsertContentAddressed. The caller could not have
+// put that key in the record, so the key field is not checked.
+func (d *Driver) prepareGenerated(collection, resource string, data []byte) ([]byte, error) {
+	return d.prepareRecord(collection, resource, data, false)
+}
+
+func (d *Driver) prepareRecord(collection, resource string, data []byte, checkKey bool) ([]byte, error) {
+	b, err := d.computeFields(collection, resource, data)
 	if err != nil {
+		return nil, err
+	}
+	b = d.normalizeFields(b)
+
+	if checkKey {
+		if err := d.checkKeyField(collection, resource, b); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := d.checkRequired(collection, b); err != nil {
+		return nil, err
+	}
+
+	if err := d.ensureCollection(collection); err != nil {
+		return nil, err
+	}
+
+	if err := d.checkSchema(collection, b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// write atomically replaces a record with b, logging the change with
+// Options.TrackChanges. Callers must hold the collection mutex.
+func (d *Driver) write(collection, resource string, b []byte) error {
+	if err := d.ensureCollection(collection); err != nil {
+		return err
+	}
+
+	before, tracked := d.previousVersion(collection, resource)
+	if err := d.writeFile(d.recordPath(collection, resource), b); err != nil {
+		return err
+	}
+
+	d.recordModified(collection, resource, false)
+	d.updateIndexes(collection, resource, b)
+	d.recordChange(collection, resource, tracked, before, b)
+	return nil
+}
+
+// writeRecord is write for a record b returned by prepare: once the record
+// is stored, its fields extend the inferred schema. Callers must hold the
+// collection mutex.
+func (d *Driver) writeRecord(collection, resource string, b []byte) error {
+	if err := d.write(collection, resource, b); err != nil {
+		return err
+	}
+
+	if err := d.learnSchema(collection, b); err != nil {
+		d.logger.Warn("Unable to update schema of %s: %v", collection, err)
+	}
+	return nil
+}
+
+// writeFile atomically replaces the file at fnlPath with b.
+func (d *Driver) writeFile(fnlPath string, b []byte) error {
+	tempPath := fnlPath + ".tmp"
+	dir := filepath.Dir(fnlPath)
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
 		return err
 	}
 
-	b = append(b, byte('\n'))
+	if d.lengthHeader {
+		b = addLengthHeader(b)
+	}
 
 	if err := ioutil.WriteFile(tempPath, b, 0644); err != nil {
 		return err
 	}
 
-	return os.Rename(tempPath, fnlPath)
+	if err := os.Rename(tempPath, fnlPath); err != nil {
+		return err
+	}
+
+	d.scheduleSync(fnlPath, dir)
+	return nil
 }
 
 func (d *Driver) Read(collection, resource string, v interface{}) error {
+	b, err := d.readRecord(collection, resource)
+	if err != nil {
+		return err
+	}
+
+	name, _, _ := d.transformKeys(collection, "")
+	if t := d.getTransform(name); t != nil && t.dec != nil {
+		return t.dec(b, v)
+	}
+
+	if err := json.Unmarshal(b, &v); err != nil {
+		return d.decodeError(collection, resource, b, err)
+	}
+	return nil
+}
+
+// ReadValue reads a record of any JSON type: a map[string]interface{} for
+// an object, []interface{} for an array, json.Number, string, bool or nil.
+func (d *Driver) ReadValue(collection, resource string) (interface{}, error) {
+	b, err := d.readRecord(collection, resource)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := decodeDocument(b)
+	if err != nil {
+		return nil, d.decodeError(collection, resource, b, err)
+	}
+	return value, nil
+}
+
+// readRecord returns a record's content as Read would decode it.
+func (d *Driver) readRecord(collection, resource string) ([]byte, error) {
+	collection, resource, err := d.transformKeys(collection, resource)
+	if err != nil {
+		return nil, err
+	}
+
 	if collection == "" {
-		return fmt.Errorf("Missing collection- no place to save record")
+		return nil, ErrMissingCollection
 	}
 
 	if resource == "" {
-		return fmt.Errorf("Missing resource- no name for the record")
+		return nil, ErrMissingResource
 	}
 
-	record := filepath.Join(d.dir, collection, resource+".json")
+	op := d.startOp("read", collection, resource)
+	defer op.done()
+	if err := d.checkFrozen(collection); err != nil {
+		return nil, err
+	}
+	op.locked()
+
+	record := d.recordPath(collection, resource)
 
 	if _, err := stat(record); err != nil {
-		return err
+		return nil, err
 	}
 
-	b, err := ioutil.ReadFile(record + ".json")
+	b, err := d.readFile(record)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return json.Unmarshal(b, &v)
+	if b, err = d.applyAliases(collection, resource, b); err != nil {
+		return nil, err
+	}
+	op.moved(len(b))
+	return d.normalizeFields(b), nil
 }
 
 func (d *Driver) ReadAll(collection string) ([]string, error) {
+	return d.ReadAllContext(context.Background(), collection)
+}
+
+// ReadAllContext is ReadAll stopping with ctx.Err() once ctx is done. The
+// context is checked around every file read, so a read stuck on a slow
+// mount can't hold the call past its deadline; the stuck read itself is
+// left to finish in the background.
+func (d *Driver) ReadAllContext(ctx context.Context, collection string) ([]string, error) {
+	keyed, err := d.ReadAllWithKeysContext(ctx, collection)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []string
+	for _, record := range keyed {
+		records = append(records, string(record.Data))
+	}
+	return records, nil
+}
+
+// ReadAllWithKeys returns every record in a collection along with its
+// resource name, in Options.RecordOrder, by resource name by default.
+func (d *Driver) ReadAllWithKeys(collection string) ([]KeyedRecord, error) {
+	return d.ReadAllWithKeysContext(context.Background(), collection)
+}
+
+// ReadAllWithKeysContext is ReadAllWithKeys honoring ctx like ReadAllContext.
+func (d *Driver) ReadAllWithKeysContext(ctx context.Context, collection string) ([]KeyedRecord, error) {
+	collection, _, err := d.transformKeys(collection, "")
+	if err != nil {
+		return nil, err
+	}
+
+	op := d.startOp("readAll", collection, "")
+	defer op.done()
+	size := 0
+	var records []KeyedRecord
+	err = d.forEachRecordContext(ctx, collection, func(resource string, b []byte) error {
+		records = append(records, KeyedRecord{Key: resource, Data: b})
+		size += len(b)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	op.moved(size)
+	return records, nil
+}
+
+// ConcurrentSafeReadAll is ReadAll holding the collection lock from the
+// listing until the last file is read, so the records all come from one
+// moment: no write or delete of the collection can land part way through.
+// Writers, and other callers of ConcurrentSafeReadAll, wait until it
+// returns. Like ReadAll it is allowed under FreezeWrites. Field aliases
+// are applied but records are not migrated.
+func (d *Driver) ConcurrentSafeReadAll(collection string) ([]string, error) {
+	collection, _, err := d.transformKeys(collection, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if collection == "" {
+		return nil, ErrMissingCollection
+	}
+
+	mutex, err := d.lockForRead(collection)
+	if err != nil {
+		return nil, err
+	}
+	defer mutex.Unlock()
+
+	// Alias migration would take the lock we hold, so only rename.
+	aliases := d.fieldAliases(collection)
+	var records []string
+	err = d.forEachFile(collection, func(resource string, b []byte) error {
+		if len(aliases) > 0 {
+			b, _ = renameFields(b, aliases)
+		}
+		records = append(records, string(d.normalizeFields(b)))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// forEachRecord calls fn with the contents of every record in a collection,
+// in Options.RecordOrder, with field aliases applied. Iteration stops at the
+// first error returned by fn.
+func (d *Driver) forEachRecord(collection string, fn func(resource string, b []byte) error) error {
+	return d.forEachRecordContext(context.Background(), collection, fn)
+}
+
+func (d *Driver) forEachRecordContext(ctx context.Context, collection string, fn func(resource string, b []byte) error) error {
+	return d.forEachFileContext(ctx, collection, func(resource string, b []byte) error {
+		b, err := d.applyAliases(collection, resource, b)
+		if err != nil {
+			return err
+		}
+		return fn(resource, d.normalizeFields(b))
+	})
+}
+
+// forEachFile is forEachRecord without any read-time transformation.
+func (d *Driver) forEachFile(collection string, fn func(resource string, b []byte) error) error {
+	return d.forEachFileContext(context.Background(), collection, fn)
+}
+
+func (d *Driver) forEachFileContext(ctx context.Context, collection string, fn func(resource string, b []byte) error) error {
 	if collection == "" {
-		return nil, fmt.Errorf("Missing collection- no place to save record")
+		return ErrMissingCollection
+	}
+
+	if err := d.checkFrozen(collection); err != nil {
+		return err
 	}
 
 	dir := filepath.Join(d.dir, collection)
 	if _, err := stat(dir); err != nil {
-		return nil, err
+		return err
 	}
 
-	files, _ := ioutil.ReadDir(dir)
+	return d.scanFiles(ctx, collection, d.recordNames(dir), fn)
+}
 
-	var records []string
+// RecordOrder is the order collection scans return records in.
+type RecordOrder int
+
+const (
+	// RecordOrderName sorts records by resource name.
+	RecordOrderName RecordOrder = iota
+	// RecordOrderModTime sorts records by the time they were last written,
+	// oldest first, and by name between records written at the same time.
+	RecordOrderModTime
+)
 
+// recordPath returns the file holding a record's data.
+func (d *Driver) recordPath(collection, resource string) string {
+	if d.recordDirs {
+		return filepath.Join(d.dir, collection, resource, recordDataFile)
+	}
+	return joinPath(d.dir, collection, resource+".json")
+}
+
+// joinPath is filepath.Join with the elements copied once into a single
+// builder. Clean does not allocate when the joined path is already clean.
+func joinPath(elem ...string) string {
+	n := len(elem) - 1
+	for _, e := range elem {
+		n += len(e)
+	}
+
+	var b strings.Builder
+	b.Grow(n)
+	for i, e := range elem {
+		if i > 0 {
+			b.WriteByte(filepath.Separator)
+		}
+		b.WriteString(e)
+	}
+	return filepath.Clean(b.String())
+}
+
+// reservedResources are per-collection files kept by the driver itself.
+// They are never listed as records and cannot be written through Write.
+var reservedResources = map[string]bool{
+	"_schema":   true,
+	"_required": true,
+	"_manifest": true,
+}
+
+// recordNames lists the records stored in dir in the configured order.
+func (d *Driver) recordNames(dir string) []string {
+	files, _ := ioutil.ReadDir(dir)
+
+	var names []string
+	modTimes := make(map[string]time.Time)
 	for _, file := range files {
-		b, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
-		if err != nil {
-			return nil, err
+		resource, ok := d.recordName(dir, file)
+		if !ok {
+			continue
+		}
+		names = append(names, resource)
+
+		if d.recordOrder == RecordOrderModTime {
+			modTimes[resource] = file.ModTime()
+			if d.recordDirs {
+				if fi, err := os.Stat(filepath.Join(dir, resource, recordDataFile)); err == nil {
+					modTimes[resource] = fi.ModTime()
+				}
+			}
 		}
-		records = append(records, string(b))
 	}
-	return records, nil
+
+	sort.Slice(names, func(i, j int) bool {
+		if d.recordOrder == RecordOrderModTime {
+			ti, tj := modTimes[names[i]], modTimes[names[j]]
+			if !ti.Equal(tj) {
+				return ti.Before(tj)
+			}
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// recordName returns the resource stored by an entry of dir, or false if the
+// entry is not a record in the configured layout. Entries starting with a dot
+// are reserved for the driver's own bookkeeping.
+func (d *Driver) recordName(dir string, entry os.FileInfo) (string, bool) {
+	if strings.HasPrefix(entry.Name(), ".") {
+		return "", false
+	}
+
+	if !d.recordDirs {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			return "", false
+		}
+		resource := strings.TrimSuffix(entry.Name(), ".json")
+		return resource, !reservedResources[resource]
+	}
+
+	if !entry.IsDir() {
+		return "", false
+	}
+	if _, err := os.Stat(filepath.Join(dir, entry.Name(), recordDataFile)); err != nil {
+		return "", false
+	}
+	return entry.Name(), true
 }
 
 func (d *Driver) Delete(collection, resource string) error {
+	collection, resource, err := d.transformKeys(collection, resource)
+	if err != nil {
+		return err
+	}
+
+	if collection == "" {
+		return ErrMissingCollection
+	}
+
+	if reservedResources[resource] {
+		return fmt.Errorf("Invalid resource- %q is reserved", resource)
+	}
+
 	path := filepath.Join(collection, resource)
-	mutex := d.getOrCreateMutex(collection)
-	mutex.Lock()
+	op := d.startOp("delete", collection, resource)
+	defer op.done()
+	mutex, err := d.lockMutable(collection)
+	if err != nil {
+		return err
+	}
 	defer mutex.Unlock()
+	op.locked()
 
 	dir := filepath.Join(d.dir, path)
 
+	var before []byte
+	var tracked bool
+	var removed map[string][]byte
+	if resource != "" {
+		before, tracked = d.previousVersion(collection, resource)
+	} else {
+		removed = d.readForRemoval(collection, "")
+	}
+
 	switch fi, err := stat(dir); {
 	case fi == nil, err != nil:
 		return fmt.Errorf("Unable to find file or directory named %v\n", path)
 	case fi.Mode().IsDir():
-		return os.RemoveAll(dir)
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
 	case fi.Mode().IsRegular():
-		return os.Remove(dir + ".json")
+		if err := os.Remove(dir + ".json"); err != nil {
+			return err
+		}
 	}
+
+	if resource == "" {
+		d.dropModIndex(collection)
+		d.forgetCollection(collection)
+		d.recordRemovals(collection, removed)
+	} else {
+		if err := d.removeAttachments(collection, resource); err != nil {
+			return err
+		}
+		d.recordModified(collection, resource, true)
+		d.recordChange(collection, resource, tracked, before, nil)
+	}
+	d.updateIndexes(collection, resource, nil)
+
+	d.scheduleSync(filepath.Dir(dir))
 	return nil
 }
 
+// forgetCollection drops the cached settings of a deleted collection, as
+// the files they were read from went with it.
+func (d *Driver) forgetCollection(collection string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	delete(d.required, collection)
+	delete(d.schemas, collection)
+	delete(d.manifests, collection)
+}
+
+// Touch sets a record's modification time to now without rewriting it.
+func (d *Driver) Touch(collection, resource string) error {
+	collection, resource, err := d.transformKeys(collection, resource)
+	if err != nil {
+		return err
+	}
+
+	if collection == "" {
+		return ErrMissingCollection
+	}
+
+	if resource == "" {
+		return ErrMissingResource
+	}
+
+	mutex, err := d.lockWritable(collection)
+	if err != nil {
+		return err
+	}
+	defer mutex.Unlock()
+
+	now := time.Now()
+	err = os.Chtimes(d.recordPath(collection, resource), now, now)
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	d.recordModified(collection, resource, false)
+	return nil
+}
+
+// transformKeys applies Options.KeyTransformer to non-empty names.
+func (d *Driver) transformKeys(collection, resource string) (string, string, error) {
+	if d.keyTransformer == nil {
+		return collection, resource, nil
+	}
+
+	if d.transformCollections && collection != "" {
+		if collection = d.keyTransformer(collection); strings.ContainsAny(collection, `/\`) {
+			return "", "", fmt.Errorf("Invalid collection- transformed name %q contains a path separator", collection)
+		}
+	}
+
+	if resource != "" {
+		if resource = d.keyTransformer(resource); strings.ContainsAny(resource, `/\`) {
+			return "", "", fmt.Errorf("Invalid resource- transformed name %q contains a path separator", resource)
+		}
+	}
+	return collection, resource, nil
+}
+
 func (d *Driver) getOrCreateMutex(collection string) *sync.Mutex {
 	d.mutex.Lock()
 	defer d.mutex.Unlock()
@@ -203,6 +1035,7 @@ func main() {
 	if err != nil {
 		fmt.Println("Error", err)
 	}
+	defer db.Close()
 
 	employees := []User{
 		{"john", "25", "1234567890", "ABC Inc", Address{"New York", "NY", "USA", "10001"}},
@@ -0,0 +1,453 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestDriver opens a driver on a fresh temporary directory, closed when
+// the test ends.
+func newTestDriver(tb testing.TB, opts *Options) *Driver {
+	tb.Helper()
+	db, err := New(tb.TempDir(), opts)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { db.Close() })
+	return db
+}
+
+var benchUser = User{"john", "25", "1234567890", "ABC Inc", Address{"New York", "NY", "USA", "10001"}}
+
+func BenchmarkWrite(b *testing.B) {
+	db := newTestDriver(b, nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := db.Write("users", "john", benchUser); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestConcurrentSafeReadAllUnderWriteFreeze(t *testing.T) {
+	db := newTestDriver(t, &Options{FreezeWait: time.Millisecond})
+	db.Write("users", "john", benchUser)
+
+	unfreeze, err := db.FreezeCollection("users", FreezeWrites)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unfreeze()
+
+	records, err := db.ConcurrentSafeReadAll("users")
+	if err != nil || len(records) != 1 {
+		t.Fatalf("ConcurrentSafeReadAll = %d records, %v", len(records), err)
+	}
+
+	if err := db.Write("users", "jane", benchUser); !errors.Is(err, ErrFrozen) {
+		t.Fatalf("Write under FreezeWrites = %v, want ErrFrozen", err)
+	}
+}
+
+func TestConcurrentSafeReadAllSeesOneMoment(t *testing.T) {
+	db := newTestDriver(t, nil)
+	const n = 20
+	for i := 0; i < n; i++ {
+		db.Write("gens", fmt.Sprint(i), map[string]int{"gen": 0})
+	}
+
+	// Each round rewrites every record, so a consistent scan sees at most
+	// the two generations either side of the round in progress.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for gen := 1; gen <= 10; gen++ {
+			for i := 0; i < n; i++ {
+				db.Write("gens", fmt.Sprint(i), map[string]int{"gen": gen})
+			}
+		}
+	}()
+
+	for scans := 0; scans < 20; scans++ {
+		records, err := db.ConcurrentSafeReadAll("gens")
+		if err != nil {
+			t.Fatal(err)
+		}
+		gens := make(map[string]bool)
+		for _, r := range records {
+			gens[r] = true
+		}
+		if len(records) != n || len(gens) > 2 {
+			t.Fatalf("scan saw %d records across %d generations", len(records), len(gens))
+		}
+	}
+	<-done
+}
+
+func TestTouchAdvancesModTime(t *testing.T) {
+	db := newTestDriver(t, &Options{ModifiedIndex: true})
+	db.Write("users", "john", benchUser)
+
+	path := db.recordPath("users", "john")
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := os.ReadFile(path)
+
+	since := time.Now().Add(-time.Minute)
+	if err := db.Touch("users", "john"); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fi.ModTime().After(since) {
+		t.Fatalf("mtime %v not advanced past %v", fi.ModTime(), since)
+	}
+	if b, _ := os.ReadFile(path); string(b) != string(content) {
+		t.Fatal("Touch rewrote the record")
+	}
+	if keys, _ := db.ModifiedSince("users", since); len(keys) != 1 {
+		t.Fatalf("ModifiedSince after Touch = %v, want [john]", keys)
+	}
+}
+
+func TestTouchMissingRecord(t *testing.T) {
+	db := newTestDriver(t, nil)
+	db.Write("users", "john", benchUser)
+
+	if err := db.Touch("users", "nobody"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Touch of a missing record = %v, want ErrNotFound", err)
+	}
+}
+
+// captureLogger opens a driver whose default console logger writes to a
+// pipe, and returns a function reading what it logged.
+func captureLogger(t *testing.T, opts *Options) (*Driver, func() string) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	db, err := New(t.TempDir(), opts)
+	os.Stdout = stdout
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db, func() string {
+		w.Close()
+		b, _ := io.ReadAll(r)
+		return string(b)
+	}
+}
+
+func TestLogLevel(t *testing.T) {
+	db, logged := captureLogger(t, &Options{LogLevel: "WARN"})
+	db.logger.Debug("debug message")
+	db.logger.Info("info message")
+	db.logger.Warn("warn message")
+
+	out := logged()
+	if strings.Contains(out, "debug message") || strings.Contains(out, "info message") {
+		t.Fatalf("WARN logger logged below its level: %q", out)
+	}
+	if !strings.Contains(out, "warn message") {
+		t.Fatalf("WARN logger dropped a warning: %q", out)
+	}
+}
+
+func TestLogLevelDefaultsToInfo(t *testing.T) {
+	db, logged := captureLogger(t, nil)
+	db.logger.Debug("debug message")
+	db.logger.Info("info message")
+
+	out := logged()
+	if strings.Contains(out, "debug message") || !strings.Contains(out, "info message") {
+		t.Fatalf("default logger logged %q, want info but not debug", out)
+	}
+}
+
+func TestLogLevelInvalid(t *testing.T) {
+	if _, err := New(t.TempDir(), &Options{LogLevel: "LOUD"}); err == nil {
+		t.Fatal("New with an invalid LogLevel succeeded")
+	}
+}
+
+func TestRecordOrderByName(t *testing.T) {
+	db := newTestDriver(t, nil)
+	names := []string{"m", "b", "z", "a", "k", "c", "y"}
+	for _, i := range rand.Perm(len(names)) {
+		db.Write("users", names[i], benchUser)
+	}
+
+	records, err := db.ReadAllWithKeys("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range records {
+		got = append(got, r.Key)
+	}
+	var visited []string
+	db.ForEach("users", func(resource string, b []byte) error {
+		visited = append(visited, resource)
+		return nil
+	})
+
+	want := []string{"a", "b", "c", "k", "m", "y", "z"}
+	if !reflect.DeepEqual(got, want) || !reflect.DeepEqual(visited, want) {
+		t.Fatalf("ReadAllWithKeys %v, ForEach %v, want %v", got, visited, want)
+	}
+}
+
+func TestRecordOrderModTime(t *testing.T) {
+	for _, recordDirs := range []bool{false, true} {
+		db := newTestDriver(t, &Options{RecordOrder: RecordOrderModTime, RecordDirs: recordDirs})
+		base := time.Now().Add(-time.Hour)
+		for i, name := range []string{"c", "a", "b", "d"} {
+			db.Write("users", name, benchUser)
+			mtime := base.Add(time.Duration(i) * time.Minute)
+			if name == "d" {
+				mtime = base.Add(time.Minute) // ties with a, broken by name
+			}
+			if err := os.Chtimes(db.recordPath("users", name), mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		records, err := db.ReadAllWithKeys("users")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, r := range records {
+			got = append(got, r.Key)
+		}
+		if want := []string{"c", "a", "d", "b"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("RecordDirs %v: order %v, want %v", recordDirs, got, want)
+		}
+	}
+}
+
+func TestReadValueOfAnyType(t *testing.T) {
+	db := newTestDriver(t, &Options{FieldCasing: FieldCasingPascal})
+
+	for resource, tc := range map[string]struct {
+		v    interface{}
+		want interface{}
+	}{
+		"array":  {[]int{1, 2, 3}, []interface{}{json.Number("1"), json.Number("2"), json.Number("3")}},
+		"number": {42, json.Number("42")},
+		"string": {"hello", "hello"},
+		"bool":   {true, true},
+		"object": {map[string]string{"name": "x"}, map[string]interface{}{"Name": "x"}},
+	} {
+		if err := db.Write("values", resource, tc.v); err != nil {
+			t.Fatal(err)
+		}
+		got, err := db.ReadValue("values", resource)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ReadValue(%s) = %#v, want %#v", resource, got, tc.want)
+		}
+	}
+
+	var numbers []int
+	if err := db.Read("values", "array", &numbers); err != nil || !reflect.DeepEqual(numbers, []int{1, 2, 3}) {
+		t.Fatalf("Read of an array record = %v, %v", numbers, err)
+	}
+	var n int
+	if err := db.Read("values", "number", &n); err != nil || n != 42 {
+		t.Fatalf("Read of a scalar record = %v, %v", n, err)
+	}
+	records, err := db.ReadAll("values")
+	if err != nil || len(records) != 5 {
+		t.Fatalf("ReadAll = %d records, %v", len(records), err)
+	}
+}
+
+// TestCollectionNamesTransformed calls every collection-level API with a
+// name in another case than the records were written with, under a
+// lower-casing KeyTransformer.
+func TestCollectionNamesTransformed(t *testing.T) {
+	opts := &Options{KeyTransformer: strings.ToLower, TransformCollections: true, ModifiedIndex: true, FlexibleSchema: true}
+	seed := func(t *testing.T) *Driver {
+		db := newTestDriver(t, opts)
+		db.Write("users", "john", map[string]interface{}{"name": "john", "age": 30, "score": 60, "lat": 1, "lon": 1, "v": []float64{1, 0}})
+		db.Write("users", "mary", map[string]interface{}{"name": "mary", "age": 40, "score": 80, "lat": 2, "lon": 2, "v": []float64{0, 1}})
+		return db
+	}
+
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, db *Driver) error
+	}{
+		{"SetRequiredFields", func(t *testing.T, db *Driver) error {
+			if err := db.SetRequiredFields("USERS", []string{"email"}); err != nil {
+				return err
+			}
+			var missing ErrMissingField
+			if err := db.Write("users", "ann", map[string]string{"name": "ann"}); !errors.As(err, &missing) {
+				return fmt.Errorf("Write without a required field = %v", err)
+			}
+			return nil
+		}},
+		{"RegisterFieldAliases", func(t *testing.T, db *Driver) error {
+			db.Write("users", "ann", map[string]string{"fullname": "Ann"})
+			db.RegisterFieldAliases("USERS", map[string]string{"fullname": "name"})
+			var got map[string]string
+			if err := db.Read("users", "ann", &got); err != nil || got["name"] != "Ann" {
+				return fmt.Errorf("Read = %v, %v; alias not applied", got, err)
+			}
+			if legacy, err := db.LegacyKeys("USERS"); err != nil || legacy["fullname"] != 1 {
+				return fmt.Errorf("LegacyKeys = %v, %v", legacy, err)
+			}
+			return nil
+		}},
+		{"LockSchema", func(t *testing.T, db *Driver) error {
+			if schema, err := db.InferredSchema("USERS"); err != nil || len(schema) == 0 {
+				return fmt.Errorf("InferredSchema = %v, %v", schema, err)
+			}
+			if err := db.LockSchema("USERS"); err != nil {
+				return err
+			}
+			if err := db.Write("users", "john", map[string]string{"age": "thirty"}); err == nil {
+				return fmt.Errorf("locked schema accepted a type change")
+			}
+			return nil
+		}},
+		{"ModifiedSince", func(t *testing.T, db *Driver) error {
+			if keys, err := db.ModifiedSince("USERS", time.Time{}); err != nil || len(keys) != 2 {
+				return fmt.Errorf("ModifiedSince = %v, %v", keys, err)
+			}
+			return db.RebuildIndexes("USERS")
+		}},
+		{"GroupBy", func(t *testing.T, db *Driver) error {
+			if groups, err := db.GroupBy("USERS", "name"); err != nil || len(groups) != 2 {
+				return fmt.Errorf("GroupBy = %v, %v", groups, err)
+			}
+			if values, err := db.DistinctValues("USERS", "age"); err != nil || len(values) != 2 {
+				return fmt.Errorf("DistinctValues = %v, %v", values, err)
+			}
+			return nil
+		}},
+		{"Aggregate", func(t *testing.T, db *Driver) error {
+			if sum, err := db.Aggregate("USERS", "age", AggSum); err != nil || sum != 70 {
+				return fmt.Errorf("Aggregate = %v, %v", sum, err)
+			}
+			if r, err := db.Correlation("USERS", "age", "score"); err != nil || r < 0.99 {
+				return fmt.Errorf("Correlation = %v, %v", r, err)
+			}
+			if buckets, err := db.Histogram("USERS", "age", 2); err != nil || len(buckets) != 2 {
+				return fmt.Errorf("Histogram = %v, %v", buckets, err)
+			}
+			return nil
+		}},
+		{"Analyze", func(t *testing.T, db *Driver) error {
+			db.Write("refs", "r", map[string]string{"user": "John"})
+			report, err := db.Analyze("REFS", db.ReferenceCheck("user", "USERS"))
+			if err != nil || report.Records != 1 || report.Results[0].Count != 0 {
+				return fmt.Errorf("Analyze = %+v, %v", report, err)
+			}
+			return nil
+		}},
+		{"QueryStream", func(t *testing.T, db *Driver) error {
+			records, errc := db.QueryStream(context.Background(), "USERS", func(json.RawMessage) (bool, error) { return true, nil })
+			n := 0
+			for range records {
+				n++
+			}
+			if err := <-errc; err != nil || n != 2 {
+				return fmt.Errorf("QueryStream = %d records, %v", n, err)
+			}
+			return nil
+		}},
+		{"Append", func(t *testing.T, db *Driver) error {
+			if _, err := db.Append("EVENTS", map[string]string{"kind": "login"}); err != nil {
+				return err
+			}
+			from, to := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+			if records, err := db.ScanRange("events", from, to); err != nil || len(records) != 1 {
+				return fmt.Errorf("ScanRange = %v, %v", records, err)
+			}
+			if err := db.PurgeBefore("Events", to); err != nil {
+				return err
+			}
+			if records, err := db.ScanRange("events", from, to); err != nil || len(records) != 0 {
+				return fmt.Errorf("ScanRange after PurgeBefore = %v, %v", records, err)
+			}
+			return nil
+		}},
+		{"MerkleRoot", func(t *testing.T, db *Driver) error {
+			empty, _ := db.MerkleRoot("nothing")
+			root, err := db.MerkleRoot("USERS")
+			if err != nil || reflect.DeepEqual(root, empty) {
+				return fmt.Errorf("MerkleRoot = %x, %v; collection read as empty", root, err)
+			}
+			return db.VerifyMerkleRoot("Users", root)
+		}},
+		{"CreateGeoIndex", func(t *testing.T, db *Driver) error {
+			idx, err := db.CreateGeoIndex("USERS", "lat", "lon")
+			if err != nil {
+				return err
+			}
+			if got, _ := idx.NearestN(0, 0, 5); len(got) != 2 {
+				return fmt.Errorf("NearestN = %v", got)
+			}
+			var geo strings.Builder
+			if err := db.ExportGeoJSON("USERS", "lat", "lon", &geo); err != nil || !strings.Contains(geo.String(), `"mary"`) {
+				return fmt.Errorf("ExportGeoJSON = %s, %v", geo.String(), err)
+			}
+			return nil
+		}},
+		{"CreateVectorIndex", func(t *testing.T, db *Driver) error {
+			idx, err := db.CreateVectorIndex("USERS", "v", 2)
+			if err != nil {
+				return err
+			}
+			if got, _ := idx.KNN([]float64{0, 1}, 1); len(got) != 1 || got[0] != "mary" {
+				return fmt.Errorf("KNN = %v", got)
+			}
+			return nil
+		}},
+		{"ExportEmbedPackage", func(t *testing.T, db *Driver) error {
+			dir := t.TempDir()
+			if err := db.ExportEmbedPackage("USERS", "users", dir); err != nil {
+				return err
+			}
+			b, err := os.ReadFile(filepath.Join(dir, embedDataFile))
+			if err != nil || !strings.Contains(string(b), `"mary"`) {
+				return fmt.Errorf("embedded data = %s, %v", b, err)
+			}
+			return nil
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.fn(t, seed(t)); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+)
+
+// MerkleRoot returns the root of a Merkle tree over a collection's records,
+// with leaves ordered by resource name. Each leaf hashes the resource name
+// together with the stored content, so renaming, inserting or removing a
+// record changes the root as well as editing one. An empty collection has
+// the hash of no data as its root.
+func (d *Driver) MerkleRoot(collection string) ([]byte, error) {
+	collection, _, err := d.transformKeys(collection, "")
+	if err != nil {
+		return nil, err
+	}
+
+	leaves := make(map[string][]byte)
+	var names []string
+	err = d.forEachFile(collection, func(resource string, b []byte) error {
+		h := sha256.New()
+		h.Write([]byte{0})
+		h.Write([]byte(resource))
+		h.Write([]byte{0})
+		h.Write(b)
+		leaves[resource] = h.Sum(nil)
+		names = append(names, resource)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Scans follow Options.RecordOrder, which may not be by name.
+	sort.Strings(names)
+	level := make([][]byte, len(names))
+	for i, resource := range names {
+		level[i] = leaves[resource]
+	}
+
+	if len(level) == 0 {
+		sum := sha256.Sum256(nil)
+		return sum[:], nil
+	}
+
+	for len(level) > 1 {
+		var next [][]byte
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			h := sha256.New()
+			h.Write([]byte{1})
+			h.Write(level[i])
+			h.Write(level[i+1])
+			next = append(next, h.Sum(nil))
+		}
+		level = next
+	}
+	return level[0], nil
+}
+
+// VerifyMerkleRoot returns ErrRootMismatch if the collection's current
+// Merkle root differs from expectedRoot.
+func (d *Driver) VerifyMerkleRoot(collection string, expectedRoot []byte) error {
+	root, err := d.MerkleRoot(collection)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(root, expectedRoot) {
+		return fmt.Errorf("%s: %w", collection, ErrRootMismatch)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMerkleRootIgnoresRecordOrder(t *testing.T) {
+	byName := newTestDriver(t, nil)
+	byTime := newTestDriver(t, &Options{RecordOrder: RecordOrderModTime})
+
+	for _, db := range []*Driver{byName, byTime} {
+		db.Write("users", "a", map[string]int{"n": 1})
+		db.Write("users", "b", map[string]int{"n": 2})
+		// Make b the oldest, so mod time order is b, a.
+		old := time.Now().Add(-time.Hour)
+		if err := os.Chtimes(db.recordPath("users", "b"), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := byName.MerkleRoot("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := byTime.MerkleRoot("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatal("root differs between RecordOrderName and RecordOrderModTime")
+	}
+
+	if err := byTime.Touch("users", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := byTime.VerifyMerkleRoot("users", want); err != nil {
+		t.Fatalf("root changed after Touch: %v", err)
+	}
+}
+
+func TestVerifyMerkleRootDetectsChanges(t *testing.T) {
+	db := newTestDriver(t, nil)
+	db.Write("users", "a", map[string]int{"n": 1})
+	db.Write("users", "b", map[string]int{"n": 2})
+
+	root, err := db.MerkleRoot("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.VerifyMerkleRoot("users", root); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, change := range map[string]func(){
+		"edit":   func() { db.Write("users", "a", map[string]int{"n": 3}) },
+		"insert": func() { db.Write("users", "c", map[string]int{"n": 1}) },
+		"delete": func() { db.Delete("users", "b") },
+	} {
+		change()
+		if err := db.VerifyMerkleRoot("users", root); !errors.Is(err, ErrRootMismatch) {
+			t.Fatalf("after %s: VerifyMerkleRoot = %v, want ErrRootMismatch", name, err)
+		}
+		root, _ = db.MerkleRoot("users")
+	}
+}
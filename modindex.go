@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// The modified index is an append-only log, .modified.log in the collection
+// directory, with one JSON line per write or delete. It is replayed on first
+// use, compacted once it holds mostly superseded lines, and rebuilt from
+// record mtimes when missing.
+const modIndexFile = ".modified.log"
+
+type modEntry struct {
+	Key     string `json:"k"`
+	Time    int64  `json:"t"`
+	Seq     uint64 `json:"s"`
+	Deleted bool   `json:"d,omitempty"`
+}
+
+type modIndex struct {
+	entries map[string]modEntry
+	seq     uint64
+	last    int64
+	lines   int
+}
+
+// ModifiedSince returns the resources of a collection written after t,
+// oldest first, answering from the modified index without reading records.
+// It requires Options.ModifiedIndex.
+func (d *Driver) ModifiedSince(collection string, t time.Time) ([]string, error) {
+	collection, _, err := d.transformKeys(collection, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if !d.modifiedIndex {
+		return nil, ErrNoModifiedIndex
+	}
+
+	if collection == "" {
+		return nil, ErrMissingCollection
+	}
+
+	mutex := d.getOrCreateMutex(collection)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	idx, err := d.loadModIndex(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	since := t.UnixNano()
+	var entries []modEntry
+	for _, entry := range idx.entries {
+		if entry.Time > since {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Seq < entries[j].Seq })
+
+	keys := make([]string, len(entries))
+	for i, entry := range entries {
+		keys[i] = entry.Key
+	}
+	return keys, nil
+}
+
+// RebuildIndexes discards the indexes the driver keeps for a collection and
+// rebuilds them from the records on disk, e.g. after records were changed by
+// another process: the modified index, with Options.ModifiedIndex, and every
+// GeoIndex, VectorIndex and Projector created on the collection. Writes to
+// the collection wait until it is done; projectors replay in the background.
+func (d *Driver) RebuildIndexes(collection string) error {
+	collection, _, err := d.transformKeys(collection, "")
+	if err != nil {
+		return err
+	}
+
+	if collection == "" {
+		return ErrMissingCollection
+	}
+
+	mutex, err := d.lockCollection(collection)
+	if err != nil {
+		return err
+	}
+	defer mutex.Unlock()
+
+	if d.modifiedIndex {
+		idx := &modIndex{entries: make(map[string]modEntry)}
+		if err := d.rebuildModIndex(collection, idx); err != nil {
+			return err
+		}
+
+		d.mutex.Lock()
+		d.modIndexes[collection] = idx
+		d.mutex.Unlock()
+	}
+
+	d.mutex.Lock()
+	indexes := append([]recordIndex(nil), d.indexes[collection]...)
+	d.mutex.Unlock()
+
+	for _, idx := range indexes {
+		if err := idx.rebuild(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordModified notes a write or delete in the modified index. Callers must
+// hold the collection mutex. A failed update discards the index so that it
+// is rebuilt from mtimes rather than left silently stale.
+func (d *Driver) recordModified(collection, resource string, deleted bool) {
+	if !d.modifiedIndex {
+		return
+	}
+
+	if err := d.appendModified(collection, resource, deleted); err != nil {
+		d.logger.Warn("Unable to update modified index of %s, rebuilding: %v", collection, err)
+		d.invalidateModIndex(collection)
+	}
+}
+
+// invalidateModIndex discards a collection's index so its next use rebuilds
+// it from record mtimes. Callers must hold the collection mutex.
+func (d *Driver) invalidateModIndex(collection string) {
+	if !d.modifiedIndex {
+		return
+	}
+
+	d.dropModIndex(collection)
+	os.Remove(filepath.Join(d.dir, collection, modIndexFile))
+}
+
+func (d *Driver) appendModified(collection, resource string, deleted bool) error {
+	idx, err := d.loadModIndex(collection)
+	if err != nil {
+		return err
+	}
+
+	// Never let time run backwards within a collection; the sequence
+	// number orders writes that share a timestamp.
+	now := time.Now().UnixNano()
+	if now < idx.last {
+		now = idx.last
+	}
+	idx.last = now
+	idx.seq++
+
+	entry := modEntry{Key: resource, Time: now, Seq: idx.seq, Deleted: deleted}
+	if deleted {
+		delete(idx.entries, resource)
+	} else {
+		idx.entries[resource] = entry
+	}
+
+	if idx.lines > 2*len(idx.entries)+64 {
+		return d.compactModIndex(collection, idx)
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(d.dir, collection, modIndexFile)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+
+	idx.lines++
+	d.scheduleSync(path)
+	return f.Close()
+}
+
+// loadModIndex returns the cached index of a collection, replaying its log
+// or rebuilding it the first time. Callers must hold the collection mutex.
+func (d *Driver) loadModIndex(collection string) (*modIndex, error) {
+	d.mutex.Lock()
+	idx, ok := d.modIndexes[collection]
+	d.mutex.Unlock()
+	if ok {
+		return idx, nil
+	}
+
+	idx = &modIndex{entries: make(map[string]modEntry)}
+	path := filepath.Join(d.dir, collection, modIndexFile)
+
+	b, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		if err := d.rebuildModIndex(collection, idx); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	default:
+		scanner := bufio.NewScanner(bytes.NewReader(b))
+		for scanner.Scan() {
+			var entry modEntry
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				// A torn final line from a crash; everything before it
+				// is intact.
+				continue
+			}
+			idx.apply(entry)
+			idx.lines++
+		}
+	}
+
+	d.mutex.Lock()
+	d.modIndexes[collection] = idx
+	d.mutex.Unlock()
+	return idx, nil
+}
+
+// rebuildModIndex fills idx from record mtimes and writes it out.
+func (d *Driver) rebuildModIndex(collection string, idx *modIndex) error {
+	dir := filepath.Join(d.dir, collection)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil
+	}
+
+	var entries []modEntry
+	for _, resource := range d.recordNames(dir) {
+		fi, err := os.Stat(d.recordPath(collection, resource))
+		if err != nil {
+			continue
+		}
+		entries = append(entries, modEntry{Key: resource, Time: fi.ModTime().UnixNano()})
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time < entries[j].Time })
+
+	for i := range entries {
+		entries[i].Seq = uint64(i + 1)
+		idx.apply(entries[i])
+	}
+
+	return d.compactModIndex(collection, idx)
+}
+
+func (idx *modIndex) apply(entry modEntry) {
+	if entry.Deleted {
+		delete(idx.entries, entry.Key)
+	} else {
+		idx.entries[entry.Key] = entry
+	}
+	if entry.Seq > idx.seq {
+		idx.seq = entry.Seq
+	}
+	if entry.Time > idx.last {
+		idx.last = entry.Time
+	}
+}
+
+// compactModIndex rewrites the log with one line per live record.
+func (d *Driver) compactModIndex(collection string, idx *modIndex) error {
+	entries := make([]modEntry, 0, len(idx.entries))
+	for _, entry := range idx.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Seq < entries[j].Seq })
+
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	path := filepath.Join(d.dir, collection, modIndexFile)
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		return err
+	}
+
+	idx.lines = len(entries)
+	d.scheduleSync(path, filepath.Dir(path))
+	return nil
+}
+
+func (d *Driver) dropModIndex(collection string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	delete(d.modIndexes, collection)
+}
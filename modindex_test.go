@@ -0,0 +1,100 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeOutside stores a record as another process would, bypassing the
+// driver and its indexes.
+func writeOutside(t *testing.T, db *Driver, collection, resource, content string) {
+	t.Helper()
+	path := db.recordPath(collection, resource)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectNearest(t *testing.T, idx *GeoIndex, want ...string) {
+	t.Helper()
+	got, err := idx.NearestN(0, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("NearestN = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("NearestN = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestRebuildIndexesRebuildsRegisteredIndexes(t *testing.T) {
+	db := newTestDriver(t, &Options{ModifiedIndex: true})
+	db.Write("places", "near", map[string]float64{"lat": 0.1, "lon": 0.1})
+
+	geo, err := db.CreateGeoIndex("places", "lat", "lon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vectors, err := db.CreateVectorIndex("places", "v", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	since := time.Now().Add(-time.Second)
+	writeOutside(t, db, "places", "far", `{"lat": 5, "lon": 5, "v": [1, 0]}`)
+	expectNearest(t, geo, "near")
+
+	if err := db.RebuildIndexes("places"); err != nil {
+		t.Fatal(err)
+	}
+
+	expectNearest(t, geo, "near", "far")
+	if got, _ := vectors.KNN([]float64{1, 0}, 1); len(got) != 1 || got[0] != "far" {
+		t.Fatalf("KNN = %v, want [far]", got)
+	}
+	if got, _ := db.ModifiedSince("places", since); len(got) != 2 {
+		t.Fatalf("ModifiedSince = %v, want both records", got)
+	}
+}
+
+func TestGeoIndexRebuild(t *testing.T) {
+	db := newTestDriver(t, nil)
+	db.Write("places", "near", map[string]float64{"lat": 0.1, "lon": 0.1})
+
+	geo, err := db.CreateGeoIndex("places", "lat", "lon")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeOutside(t, db, "places", "far", `{"lat": 5, "lon": 5}`)
+	if err := geo.Rebuild(); err != nil {
+		t.Fatal(err)
+	}
+	expectNearest(t, geo, "near", "far")
+}
+
+func TestRebuildIndexesReplaysProjectors(t *testing.T) {
+	db := newTestDriver(t, nil)
+	p := newBalanceProjector(t, db)
+	db.Write("events", "1", projEvent{User: "alice", Total: 10})
+
+	writeOutside(t, db, "events", "2", `{"User": "bob", "Total": 20}`)
+	if err := db.RebuildIndexes("events"); err != nil {
+		t.Fatal(err)
+	}
+	p.Wait()
+
+	if total := readTotal(t, db, "bob"); total != 20 {
+		t.Fatalf("bob's total = %d, want 20", total)
+	}
+}
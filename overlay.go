@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Overlay stages writes and deletes in memory. Reads through the overlay
+// see the staged state over what is on disk; nothing reaches disk until
+// Commit. An overlay is safe for concurrent use.
+type Overlay struct {
+	d *Driver
+
+	mutex   sync.Mutex
+	pending map[overlayKey]*overlayChange
+	order   []overlayKey
+}
+
+type overlayKey struct{ collection, resource string }
+
+// overlayChange is a staged write of data, or a delete if data is nil.
+type overlayChange struct {
+	data json.RawMessage
+}
+
+// NewOverlay returns an empty overlay over the database.
+func (d *Driver) NewOverlay() *Overlay {
+	return &Overlay{d: d, pending: make(map[overlayKey]*overlayChange)}
+}
+
+// Write stages v as a record. It is marshaled now, through any encode hook
+// set with SetTransform; the write-time checks run at Commit.
+func (o *Overlay) Write(collection, resource string, v interface{}) error {
+	key, err := o.key(collection, resource)
+	if err != nil {
+		return err
+	}
+
+	if reservedResources[key.resource] {
+		return fmt.Errorf("Invalid resource- %q is reserved", key.resource)
+	}
+
+	if !o.d.allowNull && isNil(v) {
+		return ErrNilValue
+	}
+
+	if v, err = o.d.encodeValue(key.collection, v); err != nil {
+		return err
+	}
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if err := o.d.marshal(buf, v); err != nil {
+		return err
+	}
+
+	o.stage(key, append(json.RawMessage(nil), buf.Bytes()...))
+	return nil
+}
+
+// Read decodes a record as staged in the overlay, or as on disk if the
+// overlay has not touched it. A record deleted in the overlay is
+// ErrNotFound.
+func (o *Overlay) Read(collection, resource string, v interface{}) error {
+	key, err := o.key(collection, resource)
+	if err != nil {
+		return err
+	}
+
+	o.mutex.Lock()
+	change, ok := o.pending[key]
+	o.mutex.Unlock()
+	if !ok {
+		return o.d.Read(collection, resource, v)
+	}
+
+	if change.data == nil {
+		return ErrNotFound
+	}
+
+	b := o.d.normalizeFields(change.data)
+	if t := o.d.getTransform(key.collection); t != nil && t.dec != nil {
+		return t.dec(b, v)
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return o.d.decodeError(key.collection, key.resource, b, err)
+	}
+	return nil
+}
+
+// Delete stages the removal of a record that exists in the overlay or on
+// disk.
+func (o *Overlay) Delete(collection, resource string) error {
+	key, err := o.key(collection, resource)
+	if err != nil {
+		return err
+	}
+
+	o.mutex.Lock()
+	change, ok := o.pending[key]
+	o.mutex.Unlock()
+
+	exists := ok && change.data != nil
+	if !ok {
+		_, err := stat(o.d.recordPath(key.collection, key.resource))
+		exists = err == nil
+	}
+	if !exists {
+		return ErrNotFound
+	}
+
+	o.stage(key, nil)
+	return nil
+}
+
+// Discard drops every staged change.
+func (o *Overlay) Discard() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.pending = make(map[overlayKey]*overlayChange)
+	o.order = nil
+}
+
+// Commit applies the staged changes in the order they were made, holding
+// the lock of every collection involved so that other writers see all of
+// them or none. Every staged write is encoded and checked first, and if any
+// fails nothing is applied. A commit interrupted by a crash may be partly
+// on disk. The overlay is empty after a successful commit.
+func (o *Overlay) Commit() error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	d := o.d
+	deletes := make(map[string]bool)
+	for _, key := range o.order {
+		deletes[key.collection] = deletes[key.collection] || o.pending[key].data == nil
+	}
+
+	unlock, err := d.lockCollections(deletes)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	encoded := make(map[overlayKey][]byte, len(o.order))
+	for _, key := range o.order {
+		change := o.pending[key]
+		if change.data == nil {
+			continue
+		}
+
+		if err := d.checkInsert(key.collection, d.recordPath(key.collection, key.resource)); err != nil {
+			return err
+		}
+
+		b, err := d.prepare(key.collection, key.resource, change.data)
+		if err != nil {
+			return fmt.Errorf("%s/%s: %w", key.collection, key.resource, err)
+		}
+		encoded[key] = b
+	}
+
+	for _, key := range o.order {
+		if b, ok := encoded[key]; ok {
+			if err := d.writeRecord(key.collection, key.resource, b); err != nil {
+				return err
+			}
+			continue
+		}
+
+		before, tracked := d.previousVersion(key.collection, key.resource)
+		if err := os.RemoveAll(d.recordLocation(key.collection, key.resource)); err != nil {
+			return err
+		}
+		if err := d.removeAttachments(key.collection, key.resource); err != nil {
+			return err
+		}
+		d.recordModified(key.collection, key.resource, true)
+		d.recordChange(key.collection, key.resource, tracked, before, nil)
+		d.updateIndexes(key.collection, key.resource, nil)
+		d.scheduleSync(filepath.Join(d.dir, key.collection))
+	}
+
+	o.pending = make(map[overlayKey]*overlayChange)
+	o.order = nil
+	return nil
+}
+
+func (o *Overlay) key(collection, resource string) (overlayKey, error) {
+	collection, resource, err := o.d.transformKeys(collection, resource)
+	if err != nil {
+		return overlayKey{}, err
+	}
+
+	if collection == "" {
+		return overlayKey{}, ErrMissingCollection
+	}
+
+	if resource == "" {
+		return overlayKey{}, ErrMissingResource
+	}
+	return overlayKey{collection, resource}, nil
+}
+
+// stage records a change, keeping the order in which records were first
+// touched.
+func (o *Overlay) stage(key overlayKey, data json.RawMessage) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if _, ok := o.pending[key]; !ok {
+		o.order = append(o.order, key)
+	}
+	o.pending[key] = &overlayChange{data: data}
+}
+
+// lockCollections locks several collections in name order, with
+// lockMutable for those set to true in the map and lockWritable for the
+// rest, and returns a function that unlocks them all.
+func (d *Driver) lockCollections(collections map[string]bool) (func(), error) {
+	names := make([]string, 0, len(collections))
+	for name := range collections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var mutexes []*sync.Mutex
+	unlock := func() {
+		for i := len(mutexes) - 1; i >= 0; i-- {
+			mutexes[i].Unlock()
+		}
+	}
+
+	for _, name := range names {
+		lock := d.lockWritable
+		if collections[name] {
+			lock = d.lockMutable
+		}
+
+		mutex, err := lock(name)
+		if err != nil {
+			unlock()
+			return nil, err
+		}
+		mutexes = append(mutexes, mutex)
+	}
+	return unlock, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestOverlayReadsPendingWrites(t *testing.T) {
+	db := newTestDriver(t, nil)
+	db.Write("users", "john", benchUser)
+
+	o := db.NewOverlay()
+	jane := benchUser
+	jane.Name = "jane"
+	if err := o.Write("users", "jane", jane); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Delete("users", "john"); err != nil {
+		t.Fatal(err)
+	}
+
+	var got User
+	if err := o.Read("users", "jane", &got); err != nil || got.Name != "jane" {
+		t.Fatalf("overlay Read of a staged write = %+v, %v", got, err)
+	}
+	if err := o.Read("users", "john", &got); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("overlay Read of a staged delete = %v, want ErrNotFound", err)
+	}
+
+	// Nothing is on disk yet.
+	if err := db.Read("users", "jane", &got); err == nil {
+		t.Fatal("staged write visible outside the overlay")
+	}
+	if err := db.Read("users", "john", &got); err != nil {
+		t.Fatalf("staged delete applied before Commit: %v", err)
+	}
+
+	if err := o.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Read("users", "jane", &got); err != nil || got.Name != "jane" {
+		t.Fatalf("Read after Commit = %+v, %v", got, err)
+	}
+	if _, err := os.Stat(db.recordPath("users", "john")); !os.IsNotExist(err) {
+		t.Fatalf("deleted record still on disk after Commit: %v", err)
+	}
+}
+
+func TestOverlayDiscardLeavesDiskUnchanged(t *testing.T) {
+	db := newTestDriver(t, nil)
+	db.Write("users", "john", benchUser)
+	before, _ := os.ReadFile(db.recordPath("users", "john"))
+
+	o := db.NewOverlay()
+	changed := benchUser
+	changed.Company = "Other"
+	o.Write("users", "john", changed)
+	o.Write("users", "jane", benchUser)
+	o.Discard()
+
+	if err := o.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := os.ReadFile(db.recordPath("users", "john")); string(after) != string(before) {
+		t.Fatalf("record changed by a discarded overlay:\n%s", after)
+	}
+	if _, err := os.Stat(db.recordPath("users", "jane")); !os.IsNotExist(err) {
+		t.Fatalf("discarded write reached disk: %v", err)
+	}
+
+	var got User
+	if err := o.Read("users", "john", &got); err != nil || got != benchUser {
+		t.Fatalf("overlay Read after Discard = %+v, %v, want the disk state", got, err)
+	}
+}
+
+func TestOverlayCommitIsAllOrNothing(t *testing.T) {
+	db := newTestDriver(t, &Options{KeyFields: map[string]string{"users": "Name"}})
+
+	o := db.NewOverlay()
+	o.Write("users", "john", benchUser)
+	o.Write("users", "mismatch", benchUser)
+	if err := o.Commit(); err == nil {
+		t.Fatal("Commit with a failing check succeeded")
+	}
+	if _, err := os.Stat(db.recordPath("users", "john")); !os.IsNotExist(err) {
+		t.Fatalf("valid write applied despite a failed Commit: %v", err)
+	}
+}
+
+func TestOverlayDeleteMissing(t *testing.T) {
+	db := newTestDriver(t, nil)
+	db.Write("users", "john", benchUser)
+
+	if err := db.NewOverlay().Delete("users", "nobody"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("overlay Delete of a missing record = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ReadPageAfter returns up to limit records of a collection whose resource
+// names sort after afterKey, in name order, and the cursor for the next
+// page, empty once the collection is exhausted. Pass "" for the first page.
+// Since a page starts from a key rather than an offset, records deleted or
+// added between pages never shift the rest, and a record deleted while its
+// page is read is simply left out.
+func (d *Driver) ReadPageAfter(collection, afterKey string, limit int) ([]json.RawMessage, string, error) {
+	collection, _, err := d.transformKeys(collection, "")
+	if err != nil {
+		return nil, "", err
+	}
+
+	if collection == "" {
+		return nil, "", ErrMissingCollection
+	}
+
+	if limit <= 0 {
+		return nil, "", fmt.Errorf("Invalid limit- %d", limit)
+	}
+
+	if err := d.checkFrozen(collection); err != nil {
+		return nil, "", err
+	}
+
+	dir := filepath.Join(d.dir, collection)
+	if _, err := stat(dir); err != nil {
+		return nil, "", err
+	}
+
+	names := d.recordNames(dir)
+	if d.recordOrder != RecordOrderName {
+		sort.Strings(names)
+	}
+	names = names[sort.Search(len(names), func(i int) bool { return names[i] > afterKey }):]
+
+	var records []json.RawMessage
+	for i, resource := range names {
+		if len(records) == limit {
+			return records, names[i-1], nil
+		}
+
+		b, err := d.readFile(d.recordPath(collection, resource))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, "", err
+		}
+
+		if b, err = d.applyAliases(collection, resource, b); err != nil {
+			return nil, "", err
+		}
+		records = append(records, d.normalizeFields(b))
+	}
+	return records, "", nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// readPages pages through a collection, calling between after each page.
+func readPages(t *testing.T, db *Driver, limit int, between func(page int)) []int {
+	t.Helper()
+	var seen []int
+	cursor := ""
+	for page := 0; ; page++ {
+		records, next, err := db.ReadPageAfter("users", cursor, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) > limit {
+			t.Fatalf("page %d has %d records, limit %d", page, len(records), limit)
+		}
+		for _, raw := range records {
+			var r struct{ N int }
+			if err := json.Unmarshal(raw, &r); err != nil {
+				t.Fatal(err)
+			}
+			seen = append(seen, r.N)
+		}
+		if next == "" {
+			return seen
+		}
+		if between != nil {
+			between(page)
+		}
+		cursor = next
+	}
+}
+
+func TestReadPageAfter(t *testing.T) {
+	for _, order := range []RecordOrder{RecordOrderName, RecordOrderModTime} {
+		db := newTestDriver(t, &Options{RecordOrder: order})
+		for _, i := range []int{7, 2, 9, 0, 4, 1, 8, 3, 6, 5} {
+			db.Write("users", fmt.Sprintf("%05d", i), map[string]int{"N": i})
+		}
+
+		for _, limit := range []int{1, 3, 5, 10, 20} {
+			if got, want := readPages(t, db, limit, nil), []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}; !reflect.DeepEqual(got, want) {
+				t.Fatalf("order %d, limit %d: paged %v, want %v", order, limit, got, want)
+			}
+		}
+	}
+}
+
+func TestReadPageAfterDeleteMidIteration(t *testing.T) {
+	db := newTestDriver(t, nil)
+	for i := 0; i < 10; i++ {
+		db.Write("users", fmt.Sprintf("%05d", i), map[string]int{"N": i})
+	}
+
+	got := readPages(t, db, 3, func(page int) {
+		switch page {
+		case 0:
+			// Behind the cursor: must not shift the next page.
+			db.Delete("users", "00001")
+		case 1:
+			// Ahead of the cursor: simply left out.
+			db.Delete("users", "00007")
+		}
+	})
+	if want := []int{0, 1, 2, 3, 4, 5, 6, 8, 9}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("paged %v, want %v: no duplicates or skips", got, want)
+	}
+}
+
+func TestReadPageAfterInvalidLimit(t *testing.T) {
+	db := newTestDriver(t, nil)
+	db.Write("users", "a", benchUser)
+	if _, _, err := db.ReadPageAfter("users", "", 0); err == nil {
+		t.Fatal("ReadPageAfter with limit 0 succeeded")
+	}
+}
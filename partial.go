@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// DecodePartial decodes only the named top-level fields of a JSON object
+// into their targets, e.g. {"Name": &name}, and returns every other field
+// undecoded. Fields absent from data leave their targets untouched.
+func DecodePartial(data []byte, targets map[string]interface{}) (map[string]json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	for name, target := range targets {
+		raw, ok := fields[name]
+		if !ok {
+			continue
+		}
+		if err := json.Unmarshal(raw, target); err != nil {
+			return nil, fmt.Errorf("Field %s- %v", name, err)
+		}
+		delete(fields, name)
+	}
+	return fields, nil
+}
+
+// ReadPartial reads a record and decodes it with DecodePartial.
+func (d *Driver) ReadPartial(collection, resource string, targets map[string]interface{}) (map[string]json.RawMessage, error) {
+	b, err := d.readRecord(collection, resource)
+	if err != nil {
+		return nil, err
+	}
+
+	fields, err := DecodePartial(b, targets)
+	if err != nil {
+		return nil, d.decodeError(collection, resource, b, err)
+	}
+	return fields, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestReadPartialLeavesAddressRaw(t *testing.T) {
+	db := newTestDriver(t, nil)
+	db.Write("users", "john", benchUser)
+
+	var name string
+	rest, err := db.ReadPartial("users", "john", map[string]interface{}{"Name": &name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "john" {
+		t.Fatalf("Name = %q, want john", name)
+	}
+	if _, ok := rest["Name"]; ok {
+		t.Fatal("decoded Name also returned raw")
+	}
+
+	var address Address
+	if err := json.Unmarshal(rest["Address"], &address); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(address, benchUser.Address) {
+		t.Fatalf("raw Address decodes to %+v, want %+v", address, benchUser.Address)
+	}
+}
+
+func TestDecodePartial(t *testing.T) {
+	name, age := "untouched", 0
+	rest, err := DecodePartial([]byte(`{"Name": "jane", "Age": 30, "Tags": ["a"]}`), map[string]interface{}{
+		"Age":     &age,
+		"Missing": &name,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if age != 30 || name != "untouched" {
+		t.Fatalf("Age = %d, Missing target = %q", age, name)
+	}
+	if len(rest) != 2 || string(rest["Tags"]) != `["a"]` {
+		t.Fatalf("rest = %v, want Name and Tags raw", rest)
+	}
+
+	if _, err := DecodePartial([]byte(`{"Age": "thirty"}`), map[string]interface{}{"Age": &age}); err == nil {
+		t.Fatal("DecodePartial of a mistyped field succeeded")
+	}
+	if _, err := DecodePartial([]byte(`[1]`), nil); err == nil {
+		t.Fatal("DecodePartial of an array succeeded")
+	}
+}
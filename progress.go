@@ -0,0 +1,51 @@
+package main
+
+import "time"
+
+// progress reports the progress of one long-running operation to
+// Options.OnProgress.
+type progress struct {
+	d        *Driver
+	op       string
+	total    int64
+	done     int64
+	reported int64
+	key      string
+	last     time.Time
+}
+
+// startProgress starts reporting an operation over total records, -1 if
+// unknown, or returns nil, whose methods do nothing, without OnProgress.
+func (d *Driver) startProgress(op string, total int64) *progress {
+	if d.onProgress == nil {
+		return nil
+	}
+	return &progress{d: d, op: op, total: total, reported: -1, last: time.Now()}
+}
+
+// step counts one more record handled, reporting if the interval has passed.
+func (p *progress) step(key string) {
+	if p == nil {
+		return
+	}
+
+	p.done++
+	p.key = key
+	if now := time.Now(); now.Sub(p.last) >= p.d.progressInterval {
+		p.last = now
+		p.report()
+	}
+}
+
+// finish reports where the operation stopped, whether or not it completed,
+// unless the last step already did.
+func (p *progress) finish() {
+	if p != nil && p.reported != p.done {
+		p.report()
+	}
+}
+
+func (p *progress) report() {
+	p.reported = p.done
+	p.d.onProgress(p.op, p.done, p.total, p.key)
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Projector keeps a derived collection, such as a CQRS read model, in step
+// with a source collection. Every record written to the source through the
+// driver is passed to fn, and the record it returns is written to the
+// destination. Deleting a source record leaves its projection alone.
+type Projector struct {
+	d   *Driver
+	src string
+	dst string
+	fn  func(event []byte) (resource string, projected []byte, err error)
+
+	// Events are queued by the writer, which may hold any collection
+	// locks, and projected by one goroutine at a time once it's gone.
+	mutex    sync.Mutex
+	idle     *sync.Cond
+	pending  []projectorEvent
+	draining bool
+}
+
+// projectorEvent is a source record to project, or a replay if b is nil.
+type projectorEvent struct {
+	resource string
+	b        []byte
+}
+
+// NewProjector projects future writes to srcCollection into dstCollection
+// with fn. An empty resource or nil projection from fn skips the event.
+// Projections are written in the background, in the order of the source
+// writes, after each writer has released its locks; Wait blocks until they
+// have caught up. A failed projection is logged, not returned to the writer
+// of the event. Existing records are not projected until Replay is called.
+// Projectors must not form a cycle, or they would feed each other forever.
+func NewProjector(d *Driver, srcCollection, dstCollection string, fn func(event []byte) (resource string, projected []byte, err error)) (*Projector, error) {
+	src, _, err := d.transformKeys(srcCollection, "")
+	if err != nil {
+		return nil, err
+	}
+
+	dst, _, err := d.transformKeys(dstCollection, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if src == "" || dst == "" {
+		return nil, ErrMissingCollection
+	}
+
+	if src == dst {
+		return nil, fmt.Errorf("Invalid projection- %s can't project into itself", src)
+	}
+
+	p := &Projector{d: d, src: src, dst: dst, fn: fn}
+	p.idle = sync.NewCond(&p.mutex)
+	d.addIndex(src, p)
+	return p, nil
+}
+
+// Replay rebuilds the destination from scratch: its records are deleted and
+// every record of the source is projected again, in Options.RecordOrder.
+func (p *Projector) Replay() error {
+	d := p.d
+	mutex, err := d.lockMutable(p.dst)
+	if err != nil {
+		return err
+	}
+	defer mutex.Unlock()
+
+	dir := filepath.Join(d.dir, p.dst)
+	for _, resource := range d.recordNames(dir) {
+		before, tracked := d.previousVersion(p.dst, resource)
+		if err := os.RemoveAll(d.recordLocation(p.dst, resource)); err != nil {
+			return err
+		}
+		if err := d.removeAttachments(p.dst, resource); err != nil {
+			return err
+		}
+		d.recordChange(p.dst, resource, tracked, before, nil)
+	}
+	d.invalidateModIndex(p.dst)
+
+	progress := d.startProgress("replay", -1)
+	defer progress.finish()
+
+	err = d.forEachFile(p.src, func(resource string, b []byte) error {
+		if err := p.project(b); err != nil {
+			return err
+		}
+		progress.step(resource)
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	d.updateIndexes(p.dst, "", nil)
+	d.scheduleSync(dir)
+	return nil
+}
+
+// Rebuild is Replay, so a Projector can be rebuilt like the other indexes.
+func (p *Projector) Rebuild() error {
+	return p.Replay()
+}
+
+// Wait blocks until every source write made before it has been projected.
+// Close waits too. It must not be called while holding a collection lock,
+// as from a SetTransform hook.
+func (p *Projector) Wait() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for p.draining {
+		p.idle.Wait()
+	}
+}
+
+func (p *Projector) update(resource string, b []byte) {
+	if b != nil {
+		// b may be a pooled buffer, reused once the writer returns.
+		p.enqueue(projectorEvent{resource: resource, b: append([]byte(nil), b...)})
+	}
+}
+
+// rebuild runs when the whole source changed, e.g. after PurgeBefore.
+func (p *Projector) rebuild() error {
+	p.enqueue(projectorEvent{})
+	return nil
+}
+
+func (p *Projector) enqueue(event projectorEvent) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	// A replay reprojects every source record, covering the events before it.
+	if event.b == nil {
+		p.pending = p.pending[:0]
+	}
+	p.pending = append(p.pending, event)
+
+	if !p.draining {
+		p.draining = true
+		go p.drain()
+	}
+}
+
+func (p *Projector) drain() {
+	for {
+		p.mutex.Lock()
+		if len(p.pending) == 0 {
+			p.pending = nil
+			p.draining = false
+			p.idle.Broadcast()
+			p.mutex.Unlock()
+			return
+		}
+		event := p.pending[0]
+		p.pending = p.pending[1:]
+		p.mutex.Unlock()
+
+		if event.b == nil {
+			if err := p.Replay(); err != nil {
+				p.d.logger.Warn("Unable to replay %s into %s: %v", p.src, p.dst, err)
+			}
+			continue
+		}
+
+		mutex, err := p.d.lockWritable(p.dst)
+		if err == nil {
+			err = p.project(event.b)
+			mutex.Unlock()
+		}
+		if err != nil {
+			p.d.logger.Warn("Unable to project %s/%s into %s: %v", p.src, event.resource, p.dst, err)
+		}
+	}
+}
+
+// project writes the projection of one event, seen as Read would return it.
+// Callers must hold the destination mutex.
+func (p *Projector) project(b []byte) error {
+	b, _ = renameFields(b, p.d.fieldAliases(p.src))
+	resource, projected, err := p.fn(p.d.normalizeFields(b))
+	if err != nil || resource == "" || projected == nil {
+		return err
+	}
+
+	if reservedResources[resource] {
+		return fmt.Errorf("Invalid resource- %q is reserved", resource)
+	}
+
+	if !json.Valid(projected) {
+		return fmt.Errorf("Invalid projection- %s is not valid JSON", resource)
+	}
+
+	projected, err = p.d.prepare(p.dst, resource, projected)
+	if err != nil {
+		return err
+	}
+	return p.d.writeRecord(p.dst, resource, projected)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+type projEvent struct {
+	User  string
+	Total int
+}
+
+func newBalanceProjector(t *testing.T, db *Driver) *Projector {
+	t.Helper()
+	p, err := NewProjector(db, "events", "balances", func(event []byte) (string, []byte, error) {
+		var e projEvent
+		if err := json.Unmarshal(event, &e); err != nil {
+			return "", nil, err
+		}
+		b, err := json.Marshal(map[string]int{"total": e.Total})
+		return e.User, b, err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// within fails the test if fn does not return in time, e.g. on a deadlock.
+func within(t *testing.T, d time.Duration, fn func()) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn()
+	}()
+	select {
+	case <-done:
+	case <-time.After(d):
+		t.Fatal("timed out, likely deadlocked")
+	}
+}
+
+func readTotal(t *testing.T, db *Driver, user string) int {
+	t.Helper()
+	var balance struct{ Total int }
+	if err := db.Read("balances", user, &balance); err != nil {
+		t.Fatal(err)
+	}
+	return balance.Total
+}
+
+func TestProjectorProjectsWrites(t *testing.T) {
+	db := newTestDriver(t, nil)
+	p := newBalanceProjector(t, db)
+
+	for i := 1; i <= 20; i++ {
+		if err := db.Write("events", "e", projEvent{User: "ann", Total: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p.Wait()
+
+	if got := readTotal(t, db, "ann"); got != 20 {
+		t.Fatalf("total = %d, want the last write, 20", got)
+	}
+}
+
+func TestProjectorReplay(t *testing.T) {
+	db := newTestDriver(t, nil)
+	db.Write("events", "e1", projEvent{User: "ann", Total: 1})
+	db.Write("events", "e2", projEvent{User: "bob", Total: 2})
+
+	p := newBalanceProjector(t, db)
+	if err := p.Replay(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readTotal(t, db, "bob"); got != 2 {
+		t.Fatalf("total = %d, want 2", got)
+	}
+}
+
+func TestProjectorOverlayCommitDoesNotDeadlock(t *testing.T) {
+	db := newTestDriver(t, nil)
+	p := newBalanceProjector(t, db)
+
+	within(t, 5*time.Second, func() {
+		o := db.NewOverlay()
+		o.Write("events", "e1", projEvent{User: "ann", Total: 3})
+		o.Write("balances", "bob", map[string]int{"total": 4})
+		if err := o.Commit(); err != nil {
+			t.Error(err)
+		}
+		p.Wait()
+	})
+
+	if got := readTotal(t, db, "ann"); got != 3 {
+		t.Fatalf("total = %d, want 3", got)
+	}
+}
+
+func TestProjectorRelocateDoesNotDeadlock(t *testing.T) {
+	db := newTestDriver(t, nil)
+	p := newBalanceProjector(t, db)
+	db.Write("balances", "moved", projEvent{User: "carl", Total: 5})
+	p.Wait()
+
+	within(t, 5*time.Second, func() {
+		n, err := db.RelocateWhere("balances", "events", func(json.RawMessage) (bool, error) { return true, nil })
+		if err != nil || n != 1 {
+			t.Errorf("RelocateWhere = %d, %v", n, err)
+		}
+		p.Wait()
+	})
+
+	if got := readTotal(t, db, "carl"); got != 5 {
+		t.Fatalf("total = %d, want 5", got)
+	}
+}
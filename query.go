@@ -0,0 +1,404 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// GroupBy counts the records of a collection per distinct value of the field
+// at fieldPath. Nested fields are addressed with dots, e.g. "Address.State".
+// Records that are not objects or lack the field are not counted.
+func (d *Driver) GroupBy(collection, fieldPath string) (map[string]int, error) {
+	collection, _, err := d.transformKeys(collection, "")
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string]int)
+	err = d.forEachRecord(collection, func(resource string, b []byte) error {
+		doc, err := decodeDocument(b)
+		if err != nil {
+			return d.decodeError(collection, resource, b, err)
+		}
+
+		value, ok := lookupField(doc, fieldPath)
+		if !ok {
+			return nil
+		}
+		groups[groupKey(value)]++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// DistinctValues returns the distinct values of the field at fieldPath
+// across a collection, sorted: null, then false and true, then numbers by
+// value, then strings, then objects and arrays by their JSON. Numbers are
+// json.Number values; numerically equal numbers such as 1 and 1.0 count as
+// one, keeping the spelling seen first. Records lacking the field are
+// skipped.
+func (d *Driver) DistinctValues(collection, fieldPath string) ([]interface{}, error) {
+	collection, _, err := d.transformKeys(collection, "")
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var values []interface{}
+	err = d.forEachRecord(collection, func(resource string, b []byte) error {
+		doc, err := decodeDocument(b)
+		if err != nil {
+			return d.decodeError(collection, resource, b, err)
+		}
+
+		value, ok := lookupField(doc, fieldPath)
+		if !ok {
+			return nil
+		}
+
+		key := distinctKey(value)
+		if !seen[key] {
+			seen[key] = true
+			values = append(values, value)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(values, func(i, j int) bool { return compareValues(values[i], values[j]) < 0 })
+	return values, nil
+}
+
+// distinctKey identifies a decoded JSON value, numbers by exact value.
+func distinctKey(value interface{}) string {
+	if n, ok := value.(json.Number); ok {
+		if r, ok := new(big.Rat).SetString(string(n)); ok {
+			return "n" + r.RatString()
+		}
+	}
+	b, _ := json.Marshal(value)
+	return string(b)
+}
+
+// compareValues orders decoded JSON values as described on DistinctValues.
+func compareValues(a, b interface{}) int {
+	if ra, rb := valueRank(a), valueRank(b); ra != rb {
+		return ra - rb
+	}
+
+	switch a := a.(type) {
+	case bool:
+		if a == b.(bool) {
+			return 0
+		}
+		if !a {
+			return -1
+		}
+		return 1
+	case json.Number:
+		ra, okA := new(big.Rat).SetString(string(a))
+		rb, okB := new(big.Rat).SetString(string(b.(json.Number)))
+		if okA && okB {
+			return ra.Cmp(rb)
+		}
+		return strings.Compare(string(a), string(b.(json.Number)))
+	case string:
+		return strings.Compare(a, b.(string))
+	}
+	return strings.Compare(groupKey(a), groupKey(b))
+}
+
+func valueRank(value interface{}) int {
+	switch value.(type) {
+	case nil:
+		return 0
+	case bool:
+		return 1
+	case json.Number:
+		return 2
+	case string:
+		return 3
+	}
+	return 4
+}
+
+// ForEach calls fn with the resource name and JSON of every record in a
+// collection, in Options.RecordOrder, stopping at the first error fn returns.
+func (d *Driver) ForEach(collection string, fn func(resource string, b []byte) error) error {
+	collection, _, err := d.transformKeys(collection, "")
+	if err != nil {
+		return err
+	}
+	return d.forEachRecord(collection, fn)
+}
+
+// MapReduce maps every record of a collection to a key and value, groups the
+// values by key in record order, and reduces each group to one value. It is
+// a function rather than a method because methods can't be generic.
+func MapReduce[K comparable, V any](d *Driver, collection string, mapper func([]byte) (K, V), reducer func(K, []V) V) (map[K]V, error) {
+	groups := make(map[K][]V)
+	err := d.ForEach(collection, func(resource string, b []byte) error {
+		k, v := mapper(b)
+		groups[k] = append(groups[k], v)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(map[K]V, len(groups))
+	for k, values := range groups {
+		results[k] = reducer(k, values)
+	}
+	return results, nil
+}
+
+// CountWhere returns how many records of a collection match accepts. The
+// scan stops at the first error match returns.
+func (d *Driver) CountWhere(collection string, match func(json.RawMessage) (bool, error)) (int, error) {
+	count := 0
+	err := d.ForEach(collection, func(resource string, b []byte) error {
+		ok, err := match(b)
+		if ok && err == nil {
+			count++
+		}
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// QueryStream sends the records of a collection accepted by match on the
+// first channel, one at a time, so only the record being handled is held
+// in memory. Once the scan ends the record channel is closed and the
+// error channel yields the error that stopped it, if any, and is closed.
+// Cancelling ctx stops the scan with ctx.Err().
+func (d *Driver) QueryStream(ctx context.Context, collection string, match func(json.RawMessage) (bool, error)) (<-chan json.RawMessage, <-chan error) {
+	records := make(chan json.RawMessage)
+	errc := make(chan error, 1)
+
+	collection, _, err := d.transformKeys(collection, "")
+	if err != nil {
+		errc <- err
+		close(errc)
+		close(records)
+		return records, errc
+	}
+
+	go func() {
+		defer close(errc)
+		defer close(records)
+
+		err := d.forEachRecordContext(ctx, collection, func(resource string, b []byte) error {
+			ok, err := match(b)
+			if err != nil || !ok {
+				return err
+			}
+
+			select {
+			case records <- b:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if err != nil {
+			errc <- err
+		}
+	}()
+
+	return records, errc
+}
+
+// AggOp is an aggregate computed by Aggregate.
+type AggOp int
+
+const (
+	AggSum AggOp = iota + 1
+	AggAvg
+	AggMin
+	AggMax
+	AggCount
+)
+
+func (op AggOp) String() string {
+	switch op {
+	case AggSum:
+		return "sum"
+	case AggAvg:
+		return "avg"
+	case AggMin:
+		return "min"
+	case AggMax:
+		return "max"
+	case AggCount:
+		return "count"
+	}
+	return fmt.Sprintf("AggOp(%d)", int(op))
+}
+
+// Aggregate computes op over the numeric values of the field at fieldPath in
+// a single pass over the collection. Records where the field is missing or
+// not a JSON number, including numbers stored as strings, are skipped, and
+// AggCount counts only the records that were not. Avg, Min and Max fail if
+// no record has a numeric value.
+func (d *Driver) Aggregate(collection, fieldPath string, op AggOp) (float64, error) {
+	collection, _, err := d.transformKeys(collection, "")
+	if err != nil {
+		return 0, err
+	}
+
+	if op < AggSum || op > AggCount {
+		return 0, fmt.Errorf("Invalid aggregate- %v", op)
+	}
+
+	var sum, min, max float64
+	count := 0
+	err = d.forEachRecord(collection, func(resource string, b []byte) error {
+		doc, err := decodeDocument(b)
+		if err != nil {
+			return d.decodeError(collection, resource, b, err)
+		}
+
+		value, _ := lookupField(doc, fieldPath)
+		n, ok := value.(json.Number)
+		if !ok {
+			return nil
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return nil
+		}
+
+		if count == 0 || f < min {
+			min = f
+		}
+		if count == 0 || f > max {
+			max = f
+		}
+		sum += f
+		count++
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	switch op {
+	case AggSum:
+		return sum, nil
+	case AggCount:
+		return float64(count), nil
+	}
+
+	if count == 0 {
+		return 0, fmt.Errorf("Unable to compute %v- no numeric %s in %s", op, fieldPath, collection)
+	}
+
+	switch op {
+	case AggAvg:
+		return sum / float64(count), nil
+	case AggMin:
+		return min, nil
+	default:
+		return max, nil
+	}
+}
+
+// Correlation returns the Pearson correlation coefficient of the numeric
+// fields at fieldA and fieldB over the records that have both. It returns
+// NaN and an error wrapping ErrZeroVariance if either field does not vary.
+func (d *Driver) Correlation(collection, fieldA, fieldB string) (float64, error) {
+	collection, _, err := d.transformKeys(collection, "")
+	if err != nil {
+		return 0, err
+	}
+
+	// Welford's online update keeps the sums accurate for large values.
+	var n, meanA, meanB, varA, varB, cov float64
+	err = d.forEachRecord(collection, func(resource string, b []byte) error {
+		doc, err := decodeDocument(b)
+		if err != nil {
+			return d.decodeError(collection, resource, b, err)
+		}
+
+		x, ok := numberField(doc, fieldA)
+		if !ok {
+			return nil
+		}
+		y, ok := numberField(doc, fieldB)
+		if !ok {
+			return nil
+		}
+
+		n++
+		dx := x - meanA
+		meanA += dx / n
+		dy := y - meanB
+		meanB += dy / n
+		varA += dx * (x - meanA)
+		varB += dy * (y - meanB)
+		cov += dx * (y - meanB)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if n < 2 || varA == 0 || varB == 0 {
+		return math.NaN(), fmt.Errorf("%s and %s in %s over %d records: %w", fieldA, fieldB, collection, int(n), ErrZeroVariance)
+	}
+	return cov / math.Sqrt(varA*varB), nil
+}
+
+// decodeDocument decodes a record keeping numbers as json.Number so that
+// their original text, and precision, survive.
+func decodeDocument(b []byte) (interface{}, error) {
+	var doc interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// lookupField walks a dotted path through nested objects.
+func lookupField(doc interface{}, path string) (interface{}, bool) {
+	value := doc
+	for _, name := range strings.Split(path, ".") {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = obj[name]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+func groupKey(value interface{}) string {
+	switch v := value.(type) {
+	case map[string]interface{}, []interface{}:
+		b, _ := json.Marshal(v)
+		return string(b)
+	case nil:
+		return "null"
+	default:
+		return fmt.Sprint(v)
+	}
+}
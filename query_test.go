@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// employees is the fixture written by main.
+var employees = []User{
+	{"john", "25", "1234567890", "ABC Inc", Address{"New York", "NY", "USA", "10001"}},
+	{"jane", "30", "0987654321", "XYZ Corp", Address{"Los Angeles", "CA", "USA", "90001"}},
+	{"jim", "35", "1111111111", "DEF Inc", Address{"Chicago", "IL", "USA", "60601"}},
+	{"jill", "40", "2222222222", "GHI Corp", Address{"Houston", "TX", "USA", "77001"}},
+	{"jack", "45", "3333333333", "JKL Inc", Address{"Miami", "FL", "USA", "33101"}},
+	{"jane", "50", "4444444444", "MNO Corp", Address{"Seattle", "WA", "USA", "98101"}},
+	{"jim", "55", "5555555555", "PQR Inc", Address{"San Francisco", "CA", "USA", "94101"}},
+}
+
+func writeEmployees(tb testing.TB, db *Driver) {
+	tb.Helper()
+	for i, user := range employees {
+		if err := db.Write("users", fmt.Sprintf("%d_%s", i+1, user.Name), user); err != nil {
+			tb.Fatal(err)
+		}
+	}
+}
+
+func TestGroupBy(t *testing.T) {
+	db := newTestDriver(t, nil)
+	writeEmployees(t, db)
+
+	for _, tc := range []struct {
+		field string
+		want  map[string]int
+	}{
+		{"Name", map[string]int{"john": 1, "jane": 2, "jim": 2, "jill": 1, "jack": 1}},
+		{"Address.State", map[string]int{"NY": 1, "CA": 2, "IL": 1, "TX": 1, "FL": 1, "WA": 1}},
+		{"Address.Country", map[string]int{"USA": 7}},
+		{"Missing", map[string]int{}},
+	} {
+		got, err := db.GroupBy("users", tc.field)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("GroupBy(%s) = %v, want %v", tc.field, got, tc.want)
+		}
+	}
+}
+
+func TestGroupBySkipsRecordsWithoutField(t *testing.T) {
+	db := newTestDriver(t, nil)
+	db.Write("things", "a", map[string]interface{}{"kind": "x"})
+	db.Write("things", "b", map[string]interface{}{"kind": nil})
+	db.Write("things", "c", map[string]interface{}{"other": 1})
+
+	got, err := db.GroupBy("things", "kind")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{"x": 1, "null": 1}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("GroupBy(kind) = %v, want %v", got, want)
+	}
+}
+
+func TestAggregateAge(t *testing.T) {
+	db := newTestDriver(t, nil)
+	writeEmployees(t, db)
+
+	for op, want := range map[AggOp]float64{AggSum: 280, AggAvg: 40, AggMin: 25, AggMax: 55, AggCount: 7} {
+		got, err := db.Aggregate("users", "Age", op)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%v of Age = %v, want %v", op, got, want)
+		}
+	}
+}
+
+func TestAggregateSkipsNonNumbers(t *testing.T) {
+	db := newTestDriver(t, nil)
+	db.Write("things", "a", map[string]interface{}{"n": 4})
+	db.Write("things", "b", map[string]interface{}{"n": "8"})
+	db.Write("things", "c", map[string]interface{}{"other": 1})
+	db.Write("things", "d", map[string]interface{}{"n": 2})
+
+	if avg, err := db.Aggregate("things", "n", AggAvg); err != nil || avg != 3 {
+		t.Fatalf("avg = %v, %v, want 3", avg, err)
+	}
+	if count, _ := db.Aggregate("things", "n", AggCount); count != 2 {
+		t.Fatalf("count = %v, want 2", count)
+	}
+	if _, err := db.Aggregate("things", "missing", AggAvg); err == nil {
+		t.Fatal("avg of a missing field succeeded")
+	}
+	if sum, err := db.Aggregate("things", "missing", AggSum); err != nil || sum != 0 {
+		t.Fatalf("sum of a missing field = %v, %v, want 0", sum, err)
+	}
+	if _, err := db.Aggregate("things", "n", AggOp(0)); err == nil {
+		t.Fatal("invalid AggOp accepted")
+	}
+}
+
+func inState(state string) func(json.RawMessage) (bool, error) {
+	return func(raw json.RawMessage) (bool, error) {
+		var user User
+		if err := json.Unmarshal(raw, &user); err != nil {
+			return false, err
+		}
+		return user.Address.State == state, nil
+	}
+}
+
+func TestQueryStream(t *testing.T) {
+	db := newTestDriver(t, nil)
+	writeEmployees(t, db)
+
+	records, errc := db.QueryStream(context.Background(), "users", inState("CA"))
+	var names []string
+	for raw := range records {
+		var user User
+		if err := json.Unmarshal(raw, &user); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, user.Name)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, []string{"jane", "jim"}) {
+		t.Fatalf("streamed %v, want [jane jim]", names)
+	}
+}
+
+func TestQueryStreamCancel(t *testing.T) {
+	db := newTestDriver(t, nil)
+	writeEmployees(t, db)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	records, errc := db.QueryStream(ctx, "users", func(json.RawMessage) (bool, error) { return true, nil })
+	<-records
+	cancel()
+
+	// Nothing reads the records any more, so the scan must notice ctx.
+	var err error
+	within(t, time.Second, func() { err = <-errc })
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("error after cancel = %v, want context.Canceled", err)
+	}
+	if _, ok := <-records; ok {
+		t.Fatal("record channel left open after cancel")
+	}
+}
+
+func TestQueryStreamMatchError(t *testing.T) {
+	db := newTestDriver(t, nil)
+	writeEmployees(t, db)
+
+	fail := errors.New("fail")
+	records, errc := db.QueryStream(context.Background(), "users", func(json.RawMessage) (bool, error) { return false, fail })
+	for range records {
+		t.Fatal("record streamed despite the match error")
+	}
+	if err := <-errc; err != fail {
+		t.Fatalf("error = %v, want the match error", err)
+	}
+}
+
+func TestCountWhere(t *testing.T) {
+	db := newTestDriver(t, nil)
+	writeEmployees(t, db)
+
+	for state, want := range map[string]int{"CA": 2, "NY": 1, "OR": 0} {
+		got, err := db.CountWhere("users", inState(state))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("CountWhere(%s) = %d, want %d", state, got, want)
+		}
+	}
+}
+
+func TestCountWhereStopsOnError(t *testing.T) {
+	db := newTestDriver(t, nil)
+	writeEmployees(t, db)
+
+	fail := errors.New("fail")
+	calls := 0
+	_, err := db.CountWhere("users", func(json.RawMessage) (bool, error) {
+		calls++
+		return false, fail
+	})
+	if err != fail || calls != 1 {
+		t.Fatalf("CountWhere = %v after %d calls, want the predicate's error after 1", err, calls)
+	}
+}
+
+// writePoints stores one record per (x, y) pair, offset by base.
+func writePoints(tb testing.TB, db *Driver, base float64, xs, ys []float64) {
+	tb.Helper()
+	for i := range xs {
+		if err := db.Write("points", fmt.Sprintf("p%02d", i), map[string]float64{"x": base + xs[i], "y": base + ys[i]}); err != nil {
+			tb.Fatal(err)
+		}
+	}
+}
+
+func TestCorrelation(t *testing.T) {
+	xs := []float64{1, 2, 3, 4, 5}
+	tests := []struct {
+		name string
+		base float64
+		ys   []float64
+		want float64
+	}{
+		{"perfect", 0, []float64{3, 5, 7, 9, 11}, 1},
+		{"anti", 0, []float64{-3, -6, -9, -12, -15}, -1},
+		{"partial", 0, []float64{2, 4, 5, 4, 5}, 6 / math.Sqrt(60)},
+		// Welford's update keeps the result exact far from zero, where
+		// naive sums of squares lose every significant digit.
+		{"large", 1e9, []float64{2, 4, 5, 4, 5}, 6 / math.Sqrt(60)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDriver(t, nil)
+			writePoints(t, db, tt.base, xs, tt.ys)
+
+			r, err := db.Correlation("points", "x", "y")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(r-tt.want) > 1e-6 {
+				t.Fatalf("Correlation = %v, want %v", r, tt.want)
+			}
+		})
+	}
+}
+
+func TestCorrelationSkipsNonNumbers(t *testing.T) {
+	db := newTestDriver(t, nil)
+	writePoints(t, db, 0, []float64{1, 2, 3}, []float64{2, 4, 6})
+	db.Write("points", "nox", map[string]float64{"y": 100})
+	db.Write("points", "stringy", map[string]interface{}{"x": "4", "y": -100})
+	db.Write("points", "nully", map[string]interface{}{"x": 5, "y": nil})
+
+	r, err := db.Correlation("points", "x", "y")
+	if err != nil || math.Abs(r-1) > 1e-9 {
+		t.Fatalf("Correlation = %v, %v, want 1 over the numeric pairs", r, err)
+	}
+}
+
+func TestCorrelationZeroVariance(t *testing.T) {
+	tests := []struct {
+		name   string
+		xs, ys []float64
+	}{
+		{"constant x", []float64{2, 2, 2}, []float64{1, 2, 3}},
+		{"constant y", []float64{1, 2, 3}, []float64{7, 7, 7}},
+		{"one record", []float64{1}, []float64{1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDriver(t, nil)
+			writePoints(t, db, 0, tt.xs, tt.ys)
+
+			r, err := db.Correlation("points", "x", "y")
+			if !errors.Is(err, ErrZeroVariance) || !math.IsNaN(r) {
+				t.Fatalf("Correlation = %v, %v, want NaN and ErrZeroVariance", r, err)
+			}
+		})
+	}
+}
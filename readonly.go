@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// collectionManifest holds persistent per-collection settings. It lives in
+// the collection directory as _manifest.json.
+type collectionManifest struct {
+	ReadOnly  bool `json:"readOnly,omitempty"`
+	Immutable bool `json:"immutable,omitempty"`
+}
+
+// SetCollectionReadOnly marks a collection read-only, e.g. once archived, or
+// makes it writable again. Mutations of a read-only collection fail with
+// ErrReadOnly; reads are unaffected. The flag survives restarts.
+func (d *Driver) SetCollectionReadOnly(collection string, ro bool) error {
+	collection, _, err := d.transformKeys(collection, "")
+	if err != nil {
+		return err
+	}
+
+	if collection == "" {
+		return ErrMissingCollection
+	}
+
+	mutex, err := d.lockCollection(collection)
+	if err != nil {
+		return err
+	}
+	defer mutex.Unlock()
+
+	manifest, err := d.loadManifest(collection)
+	if err != nil {
+		return err
+	}
+
+	if manifest.ReadOnly == ro {
+		return nil
+	}
+	manifest.ReadOnly = ro
+	return d.saveManifest(collection, manifest)
+}
+
+// lockWritable acquires the collection mutex for a mutation of its records,
+// failing with ErrReadOnly if the collection is read-only.
+func (d *Driver) lockWritable(collection string) (*sync.Mutex, error) {
+	mutex, err := d.lockCollection(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := d.loadManifest(collection)
+	if err == nil && manifest.ReadOnly {
+		err = fmt.Errorf("%s: %w", collection, ErrReadOnly)
+	}
+	if err != nil {
+		mutex.Unlock()
+		return nil, err
+	}
+	return mutex, nil
+}
+
+// readOnly reports whether a collection is marked read-only.
+func (d *Driver) readOnly(collection string) bool {
+	manifest, err := d.loadManifest(collection)
+	return err == nil && manifest.ReadOnly
+}
+
+// loadManifest returns the cached manifest of a collection, reading
+// _manifest.json the first time.
+func (d *Driver) loadManifest(collection string) (collectionManifest, error) {
+	d.mutex.Lock()
+	manifest, ok := d.manifests[collection]
+	d.mutex.Unlock()
+	if ok {
+		return *manifest, nil
+	}
+
+	manifest = &collectionManifest{}
+	b, err := d.readFile(d.manifestPath(collection))
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return collectionManifest{}, err
+	default:
+		if err := json.Unmarshal(b, manifest); err != nil {
+			return collectionManifest{}, fmt.Errorf("Corrupt manifest- %s: %v", collection, err)
+		}
+	}
+
+	d.mutex.Lock()
+	d.manifests[collection] = manifest
+	d.mutex.Unlock()
+	return *manifest, nil
+}
+
+// saveManifest writes and caches the manifest of a collection. Callers must
+// hold the collection mutex.
+func (d *Driver) saveManifest(collection string, manifest collectionManifest) error {
+	if err := d.ensureCollection(collection); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(manifest, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := d.writeFile(d.manifestPath(collection), append(b, byte('\n'))); err != nil {
+		return err
+	}
+
+	d.mutex.Lock()
+	d.manifests[collection] = &manifest
+	d.mutex.Unlock()
+	return nil
+}
+
+func (d *Driver) manifestPath(collection string) string {
+	return filepath.Join(d.dir, collection, "_manifest.json")
+}
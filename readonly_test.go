@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSetCollectionReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	db, err := New(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Write("archive", "john", benchUser)
+	db.Write("users", "john", benchUser)
+
+	if err := db.SetCollectionReadOnly("archive", true); err != nil {
+		t.Fatal(err)
+	}
+
+	expectReadOnly := func(db *Driver) {
+		t.Helper()
+		if err := db.Write("archive", "jane", benchUser); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("Write = %v, want ErrReadOnly", err)
+		}
+		if err := db.Delete("archive", "john"); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("Delete = %v, want ErrReadOnly", err)
+		}
+		if _, err := db.Append("archive", benchUser); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("Append = %v, want ErrReadOnly", err)
+		}
+		if err := db.Read("archive", "john", &User{}); err != nil {
+			t.Errorf("Read = %v", err)
+		}
+		if err := db.Write("users", "jane", benchUser); err != nil {
+			t.Errorf("Write to another collection = %v", err)
+		}
+	}
+	expectReadOnly(db)
+
+	// The flag survives a restart.
+	db.Close()
+	if db, err = New(dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	expectReadOnly(db)
+
+	if err := db.SetCollectionReadOnly("archive", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Write("archive", "jane", benchUser); err != nil {
+		t.Fatalf("Write after unmarking = %v", err)
+	}
+	if err := db.Delete("archive", "jane"); err != nil {
+		t.Fatalf("Delete after unmarking = %v", err)
+	}
+}
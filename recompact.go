@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// RecompactReport summarizes a Recompact run.
+type RecompactReport struct {
+	Records     int
+	Rewritten   int
+	BytesBefore int64
+	BytesAfter  int64
+	// Failed lists records left alone because they are truncated or not
+	// valid JSON.
+	Failed []string
+}
+
+// BytesSaved is how much smaller the rewritten records are, negative if
+// they grew, e.g. by gaining length headers.
+func (r RecompactReport) BytesSaved() int64 {
+	return r.BytesBefore - r.BytesAfter
+}
+
+// Recompact rewrites the records of a collection that are not in the format
+// Write would produce today: tab-indented JSON, with a length header if
+// Options.LengthHeader is set and field names in Options.FieldCasing.
+// Records already in that format are only read. Each record is rewritten
+// atomically under the collection lock, taken per record so other writes
+// interleave, and Options.RecompactPause is slept after each rewrite to
+// limit disk load. An interrupted run can simply be started again.
+func (d *Driver) Recompact(collection string) (RecompactReport, error) {
+	var report RecompactReport
+
+	collection, _, err := d.transformKeys(collection, "")
+	if err != nil {
+		return report, err
+	}
+
+	if collection == "" {
+		return report, ErrMissingCollection
+	}
+
+	dir := filepath.Join(d.dir, collection)
+	if _, err := stat(dir); err != nil {
+		return report, err
+	}
+
+	names := d.recordNames(dir)
+	progress := d.startProgress("recompact", int64(len(names)))
+	defer progress.finish()
+
+	for _, resource := range names {
+		rewritten, err := d.recompactRecord(collection, resource, &report)
+		if err != nil {
+			return report, err
+		}
+		progress.step(resource)
+
+		if rewritten && d.recompactPause > 0 {
+			time.Sleep(d.recompactPause)
+		}
+	}
+	return report, nil
+}
+
+func (d *Driver) recompactRecord(collection, resource string, report *RecompactReport) (bool, error) {
+	mutex, err := d.lockMutable(collection)
+	if err != nil {
+		return false, err
+	}
+	defer mutex.Unlock()
+
+	path := d.recordPath(collection, resource)
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	report.Records++
+
+	content, err := stripLengthHeader(path, raw)
+	if err != nil {
+		report.Failed = append(report.Failed, resource)
+		return false, nil
+	}
+
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, bytes.TrimSpace(content), "", "\t"); err != nil {
+		report.Failed = append(report.Failed, resource)
+		return false, nil
+	}
+	buf.WriteByte('\n')
+	target := d.normalizeFields(buf.Bytes())
+
+	want := target
+	if d.lengthHeader {
+		want = addLengthHeader(target)
+	}
+
+	report.BytesBefore += int64(len(raw))
+	report.BytesAfter += int64(len(want))
+	if bytes.Equal(raw, want) {
+		return false, nil
+	}
+
+	if err := d.writeFile(path, target); err != nil {
+		return false, err
+	}
+	d.recordChange(collection, resource, d.tracked(collection), content, target)
+	report.Rewritten++
+	return true, nil
+}
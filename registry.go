@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+)
+
+// openDrivers maps the resolved path of every database opened by this
+// process, and not yet closed, to its driver. Two drivers on one directory
+// would each have their own collection mutexes and exclude nothing.
+var (
+	openMutex   sync.Mutex
+	openDrivers = make(map[string]*Driver)
+)
+
+// resolveDir returns the absolute path of an existing directory with
+// symlinks evaluated, so that every alias of it resolves the same.
+func resolveDir(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
+
+// register records d as the driver for its directory, or returns the driver
+// already open there. Callers must hold openMutex.
+func (d *Driver) register(errorIfOpen bool) (*Driver, error) {
+	key, err := resolveDir(d.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if open, ok := openDrivers[key]; ok {
+		if errorIfOpen {
+			return nil, fmt.Errorf("%s: %w", d.dir, ErrAlreadyOpen)
+		}
+		return open, nil
+	}
+
+	d.openKey = key
+	openDrivers[key] = d
+	return d, nil
+}
+
+// unregister forgets d so its directory can be opened again.
+func (d *Driver) unregister() {
+	openMutex.Lock()
+	defer openMutex.Unlock()
+
+	if openDrivers[d.openKey] == d {
+		delete(openDrivers, d.openKey)
+	}
+}
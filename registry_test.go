@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// openConcurrently calls New on each path from its own goroutine at once.
+func openConcurrently(t *testing.T, paths []string, opts *Options) ([]*Driver, []error) {
+	t.Helper()
+	dbs := make([]*Driver, len(paths))
+	errs := make([]error, len(paths))
+
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i, path := range paths {
+		wg.Add(1)
+		go func(i int, path string) {
+			defer wg.Done()
+			<-start
+			dbs[i], errs[i] = New(path, opts)
+		}(i, path)
+	}
+	close(start)
+	wg.Wait()
+
+	t.Cleanup(func() {
+		for _, db := range dbs {
+			if db != nil {
+				db.Close()
+			}
+		}
+	})
+	return dbs, errs
+}
+
+// aliases returns dir along with a symlink to it and a relative spelling.
+func aliases(t *testing.T) []string {
+	t.Helper()
+	root := t.TempDir()
+	dir := filepath.Join(root, "db")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(root, "link")
+	if err := os.Symlink(dir, link); err != nil {
+		t.Skip("symlink:", err)
+	}
+	return []string{dir, link, filepath.Join(root, "link", "..", "db"), dir, link}
+}
+
+func TestNewRacingReturnsOneDriver(t *testing.T) {
+	paths := aliases(t)
+	for i := 0; i < 3; i++ {
+		paths = append(paths, paths...)
+	}
+
+	dbs, errs := openConcurrently(t, paths, nil)
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("New(%s) = %v", paths[i], err)
+		}
+		if dbs[i] != dbs[0] {
+			t.Fatalf("New(%s) returned a second driver for the same directory", paths[i])
+		}
+	}
+}
+
+func TestNewRacingErrorIfOpen(t *testing.T) {
+	paths := aliases(t)
+
+	_, errs := openConcurrently(t, paths, &Options{ErrorIfOpen: true})
+	opened := 0
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			opened++
+		case !errors.Is(err, ErrAlreadyOpen):
+			t.Fatalf("New(%s) = %v, want ErrAlreadyOpen", paths[i], err)
+		}
+	}
+	if opened != 1 {
+		t.Fatalf("%d of %d racing New calls opened the directory, want 1", opened, len(paths))
+	}
+}
+
+func TestNewAfterCloseOpensAgain(t *testing.T) {
+	dir := t.TempDir()
+	db, err := New(dir, &Options{ErrorIfOpen: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	again, err := New(dir, &Options{ErrorIfOpen: true})
+	if err != nil {
+		t.Fatalf("New after Close = %v", err)
+	}
+	defer again.Close()
+	if again == db {
+		t.Fatal("New after Close returned the closed driver")
+	}
+}
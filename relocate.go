@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// RelocateWhere moves every record of srcColl accepted by match, along with
+// its attachments, to dstColl under the same resource name, and returns how
+// many were moved. Both collections are locked, in name order, for the whole
+// move. Nothing is moved if match fails or a record already exists in
+// dstColl; if a rename fails part way, the records already moved are moved
+// back.
+func (d *Driver) RelocateWhere(srcColl, dstColl string, match func(json.RawMessage) (bool, error)) (int, error) {
+	srcColl, _, err := d.transformKeys(srcColl, "")
+	if err != nil {
+		return 0, err
+	}
+
+	if dstColl, _, err = d.transformKeys(dstColl, ""); err != nil {
+		return 0, err
+	}
+
+	if srcColl == "" || dstColl == "" {
+		return 0, ErrMissingCollection
+	}
+
+	if srcColl == dstColl {
+		return 0, fmt.Errorf("Unable to relocate- source and destination are both %s", srcColl)
+	}
+
+	// The source loses records, so it must not be immutable.
+	unlock, err := d.lockCollections(map[string]bool{srcColl: true, dstColl: false})
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	srcDir := filepath.Join(d.dir, srcColl)
+	if _, err := stat(srcDir); err != nil {
+		return 0, err
+	}
+
+	aliases := d.fieldAliases(srcColl)
+	var matched []string
+	for _, resource := range d.recordNames(srcDir) {
+		b, err := d.readFile(d.recordPath(srcColl, resource))
+		if err != nil {
+			return 0, err
+		}
+
+		// Alias migration would take the lock we hold, so only rename.
+		if len(aliases) > 0 {
+			b, _ = renameFields(b, aliases)
+		}
+
+		ok, err := match(d.normalizeFields(b))
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			continue
+		}
+
+		if _, err := os.Stat(d.recordLocation(dstColl, resource)); err == nil {
+			return 0, fmt.Errorf("Unable to relocate- %s already exists in %s", resource, dstColl)
+		}
+		matched = append(matched, resource)
+	}
+
+	if len(matched) == 0 {
+		return 0, nil
+	}
+
+	if err := d.ensureCollection(dstColl); err != nil {
+		return 0, err
+	}
+
+	moved := make(map[string][]byte)
+	for _, resource := range matched {
+		if b, tracked := d.previousVersion(srcColl, resource); tracked {
+			moved[resource] = b
+		}
+	}
+
+	for i, resource := range matched {
+		if err := d.relocate(srcColl, dstColl, resource); err != nil {
+			for _, moved := range matched[:i] {
+				if rerr := d.relocate(dstColl, srcColl, moved); rerr != nil {
+					d.logger.Error("Unable to move %s back to %s: %v", moved, srcColl, rerr)
+				}
+			}
+			return 0, err
+		}
+	}
+
+	for _, resource := range matched {
+		d.recordModified(srcColl, resource, true)
+		d.updateIndexes(srcColl, resource, nil)
+
+		d.recordModified(dstColl, resource, false)
+		if b, err := d.readFile(d.recordPath(dstColl, resource)); err == nil {
+			d.updateIndexes(dstColl, resource, b)
+		}
+
+		if b, ok := moved[resource]; ok {
+			d.recordChange(srcColl, resource, true, b, nil)
+			d.recordChange(dstColl, resource, d.tracked(dstColl), nil, b)
+		}
+	}
+
+	d.scheduleSync(srcDir, filepath.Join(d.dir, dstColl))
+	return len(matched), nil
+}
+
+// relocate renames one record, then its attachments, from one collection to
+// another. Callers must hold both collection mutexes.
+func (d *Driver) relocate(from, to, resource string) error {
+	dst := d.recordLocation(to, resource)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(d.recordLocation(from, resource), dst); err != nil {
+		return err
+	}
+
+	src := filepath.Join(d.dir, from, attachmentsDir, resource)
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		return nil
+	}
+
+	dstAttachments := filepath.Join(d.dir, to, attachmentsDir, resource)
+	err := os.MkdirAll(filepath.Dir(dstAttachments), 0755)
+	if err == nil {
+		err = os.Rename(src, dstAttachments)
+	}
+	if err != nil {
+		os.Rename(dst, d.recordLocation(from, resource))
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func olderThan(age int64) func(json.RawMessage) (bool, error) {
+	return func(raw json.RawMessage) (bool, error) {
+		var user User
+		if err := json.Unmarshal(raw, &user); err != nil {
+			return false, err
+		}
+		n, err := user.Age.Int64()
+		return n > age, err
+	}
+}
+
+func keys(t *testing.T, db *Driver, collection string) []string {
+	t.Helper()
+	records, err := db.ReadAllWithKeys(collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, r := range records {
+		names = append(names, r.Key)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func expectKeys(t *testing.T, db *Driver, collection string, want ...string) {
+	t.Helper()
+	got := keys(t, db, collection)
+	if len(got) != len(want) {
+		t.Fatalf("%s holds %v, want %v", collection, got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("%s holds %v, want %v", collection, got, want)
+		}
+	}
+}
+
+func TestRelocateWhere(t *testing.T) {
+	db := newTestDriver(t, nil)
+	writeEmployees(t, db)
+	putAttachment(t, db, "users", "7_jim", "photo.jpg", "jim")
+
+	n, err := db.RelocateWhere("users", "users_archive", olderThan(40))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Fatalf("moved %d records, want 3", n)
+	}
+
+	expectKeys(t, db, "users", "1_john", "2_jane", "3_jim", "4_jill")
+	expectKeys(t, db, "users_archive", "5_jack", "6_jane", "7_jim")
+	expectAttachments(t, db, "users_archive", "7_jim", map[string]string{"photo.jpg": "jim"})
+	expectAttachments(t, db, "users", "7_jim", nil)
+}
+
+func TestRelocateWhereMovesNothingOnConflict(t *testing.T) {
+	db := newTestDriver(t, nil)
+	writeEmployees(t, db)
+	db.Write("users_archive", "6_jane", benchUser)
+
+	if _, err := db.RelocateWhere("users", "users_archive", olderThan(40)); err == nil {
+		t.Fatal("RelocateWhere over an existing record succeeded")
+	}
+	expectKeys(t, db, "users", "1_john", "2_jane", "3_jim", "4_jill", "5_jack", "6_jane", "7_jim")
+	expectKeys(t, db, "users_archive", "6_jane")
+}
+
+func TestRelocateWhereMovesNothingOnMatchError(t *testing.T) {
+	db := newTestDriver(t, nil)
+	writeEmployees(t, db)
+
+	fail := errors.New("fail")
+	calls := 0
+	_, err := db.RelocateWhere("users", "users_archive", func(json.RawMessage) (bool, error) {
+		calls++
+		if calls == 3 {
+			return false, fail
+		}
+		return true, nil
+	})
+	if err != fail {
+		t.Fatalf("RelocateWhere = %v, want the match error", err)
+	}
+	if n := len(keys(t, db, "users")); n != 7 {
+		t.Fatalf("users holds %d records after a failed match, want 7", n)
+	}
+}
+
+func TestRelocateWhereBothWaysConcurrently(t *testing.T) {
+	db := newTestDriver(t, nil)
+	writeEmployees(t, db)
+	db.Write("archive", "x", benchUser)
+
+	all := func(json.RawMessage) (bool, error) { return true, nil }
+	within(t, 5*time.Second, func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				db.RelocateWhere("users", "archive", all)
+			}()
+			go func() {
+				defer wg.Done()
+				db.RelocateWhere("archive", "users", all)
+			}()
+		}
+		wg.Wait()
+	})
+
+	if n := len(keys(t, db, "users")) + len(keys(t, db, "archive")); n != 8 {
+		t.Fatalf("%d records across both collections, want 8", n)
+	}
+}
+
+func TestRelocateWhereRejectsSameCollection(t *testing.T) {
+	db := newTestDriver(t, nil)
+	writeEmployees(t, db)
+	if _, err := db.RelocateWhere("users", "users", olderThan(0)); err == nil {
+		t.Fatal("RelocateWhere within one collection succeeded")
+	}
+}
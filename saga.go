@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// sagasCollection holds the progress of every saga run with Execute:
+//
+//	_sagas/01JA2X3K4M5N6P7Q8R9S0T1V2W.json
+const sagasCollection = "_sagas"
+
+// Saga statuses stored in SagaState.
+const (
+	SagaRunning      = "running"
+	SagaCompleted    = "completed"
+	SagaCompensating = "compensating"
+	SagaCompensated  = "compensated"
+	SagaFailed       = "failed"
+)
+
+// SagaState is the stored progress of a saga. Completed is how many steps
+// have run forward and not yet been compensated.
+type SagaState struct {
+	ID        string    `json:"id"`
+	Steps     []string  `json:"steps"`
+	Completed int       `json:"completed"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	Updated   time.Time `json:"updated"`
+}
+
+type sagaStep struct {
+	name       string
+	forward    func(*Driver) error
+	compensate func(*Driver) error
+}
+
+// Saga is a sequence of steps, each with an action that undoes it, run as
+// a unit: if a step fails, the steps before it are compensated in reverse
+// order.
+type Saga struct {
+	d     *Driver
+	state SagaState
+	steps []sagaStep
+}
+
+// NewSaga starts an empty saga with a new time-ordered ID.
+func NewSaga(d *Driver) (*Saga, error) {
+	id, err := d.nextAppendKey(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &Saga{d: d, state: SagaState{ID: id}}, nil
+}
+
+// ID returns the saga's ID, the name of its record in _sagas.
+func (s *Saga) ID() string {
+	return s.state.ID
+}
+
+// AddStep appends a step. compensate may be nil for a step with nothing to
+// undo.
+func (s *Saga) AddStep(name string, forward, compensate func(*Driver) error) {
+	s.steps = append(s.steps, sagaStep{name, forward, compensate})
+	s.state.Steps = append(s.state.Steps, name)
+}
+
+// Execute runs the steps in order, recording progress in _sagas after each
+// one. If a step fails, or ctx is done before one starts, the completed
+// steps are compensated in reverse and the step's error is returned. If a
+// compensation fails too, the saga is left SagaFailed with the steps still
+// to undo, for PendingSagas to report after a restart.
+func (s *Saga) Execute(ctx context.Context) error {
+	s.state.Status = SagaRunning
+	if err := s.save(); err != nil {
+		return err
+	}
+
+	for _, step := range s.steps {
+		err := ctx.Err()
+		if err == nil {
+			err = step.forward(s.d)
+		}
+		if err != nil {
+			err = fmt.Errorf("Saga %s- step %s: %w", s.state.ID, step.name, err)
+			return s.compensate(err)
+		}
+
+		s.state.Completed++
+		if err := s.save(); err != nil {
+			return err
+		}
+	}
+
+	s.state.Status = SagaCompleted
+	return s.save()
+}
+
+// compensate undoes the completed steps after cause stopped the saga.
+func (s *Saga) compensate(cause error) error {
+	s.state.Status = SagaCompensating
+	s.state.Error = cause.Error()
+	if err := s.save(); err != nil {
+		return err
+	}
+
+	var failures []string
+	for s.state.Completed > 0 {
+		step := s.steps[s.state.Completed-1]
+		if step.compensate != nil {
+			if err := step.compensate(s.d); err != nil {
+				failures = append(failures, fmt.Sprintf("compensating %s: %v", step.name, err))
+				break
+			}
+		}
+
+		s.state.Completed--
+		if err := s.save(); err != nil {
+			return err
+		}
+	}
+
+	s.state.Status = SagaCompensated
+	if len(failures) > 0 {
+		s.state.Status = SagaFailed
+		s.state.Error += "; " + strings.Join(failures, "; ")
+		cause = fmt.Errorf("%w; %s", cause, strings.Join(failures, "; "))
+	}
+
+	if err := s.save(); err != nil {
+		return err
+	}
+	return cause
+}
+
+func (s *Saga) save() error {
+	s.state.Updated = time.Now().UTC()
+	b, err := json.MarshalIndent(s.state, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	mutex, err := s.d.lockCollection(sagasCollection)
+	if err != nil {
+		return err
+	}
+	defer mutex.Unlock()
+
+	return s.d.write(sagasCollection, s.state.ID, append(b, '\n'))
+}
+
+// PendingSagas returns the stored state of every saga that neither
+// completed nor was fully compensated, such as ones interrupted by a crash,
+// oldest first.
+func (d *Driver) PendingSagas() ([]SagaState, error) {
+	var pending []SagaState
+	err := d.forEachFile(sagasCollection, func(resource string, b []byte) error {
+		var state SagaState
+		if err := json.Unmarshal(b, &state); err != nil {
+			return d.decodeError(sagasCollection, resource, b, err)
+		}
+		if state.Status != SagaCompleted && state.Status != SagaCompensated {
+			pending = append(pending, state)
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return pending, nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordingSaga builds a saga over steps "a", "b" and "c" that logs every
+// forward and compensating action; fail names the step whose forward
+// action fails, and failUndo the step whose compensation does.
+func recordingSaga(t *testing.T, db *Driver, fail, failUndo string) (*Saga, *[]string) {
+	t.Helper()
+	saga, err := NewSaga(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var log []string
+	for _, name := range []string{"a", "b", "c"} {
+		name := name
+		saga.AddStep(name, func(*Driver) error {
+			if name == fail {
+				return errors.New("boom")
+			}
+			log = append(log, "do "+name)
+			return nil
+		}, func(*Driver) error {
+			if name == failUndo {
+				return errors.New("stuck")
+			}
+			log = append(log, "undo "+name)
+			return nil
+		})
+	}
+	return saga, &log
+}
+
+func sagaState(t *testing.T, db *Driver, id string) SagaState {
+	t.Helper()
+	var state SagaState
+	if err := db.Read(sagasCollection, id, &state); err != nil {
+		t.Fatal(err)
+	}
+	return state
+}
+
+func TestSagaCompletes(t *testing.T) {
+	db := newTestDriver(t, nil)
+	saga, log := recordingSaga(t, db, "", "")
+
+	if err := saga.Execute(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"do a", "do b", "do c"}; !reflect.DeepEqual(*log, want) {
+		t.Fatalf("ran %v, want %v", *log, want)
+	}
+	if state := sagaState(t, db, saga.ID()); state.Status != SagaCompleted || state.Completed != 3 {
+		t.Fatalf("state = %+v, want completed", state)
+	}
+	if pending, err := db.PendingSagas(); err != nil || len(pending) != 0 {
+		t.Fatalf("PendingSagas = %v, %v", pending, err)
+	}
+}
+
+func TestSagaCompensatesInReverse(t *testing.T) {
+	db := newTestDriver(t, nil)
+	saga, log := recordingSaga(t, db, "c", "")
+
+	err := saga.Execute(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "step c") {
+		t.Fatalf("Execute = %v, want step c's error", err)
+	}
+	if want := []string{"do a", "do b", "undo b", "undo a"}; !reflect.DeepEqual(*log, want) {
+		t.Fatalf("ran %v, want %v", *log, want)
+	}
+	if state := sagaState(t, db, saga.ID()); state.Status != SagaCompensated || state.Completed != 0 {
+		t.Fatalf("state = %+v, want compensated", state)
+	}
+	if pending, err := db.PendingSagas(); err != nil || len(pending) != 0 {
+		t.Fatalf("PendingSagas = %v, %v", pending, err)
+	}
+}
+
+func TestSagaCompensationFails(t *testing.T) {
+	db := newTestDriver(t, nil)
+	saga, log := recordingSaga(t, db, "c", "b")
+
+	err := saga.Execute(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "step c") || !strings.Contains(err.Error(), "compensating b") {
+		t.Fatalf("Execute = %v, want both failures", err)
+	}
+	// Compensation stops at the failure, so a is left for a later fix-up.
+	if want := []string{"do a", "do b"}; !reflect.DeepEqual(*log, want) {
+		t.Fatalf("ran %v, want %v", *log, want)
+	}
+
+	pending, err := db.PendingSagas()
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("PendingSagas = %v, %v", pending, err)
+	}
+	if state := pending[0]; state.ID != saga.ID() || state.Status != SagaFailed || state.Completed != 2 {
+		t.Fatalf("pending state = %+v, want failed with 2 steps to undo", state)
+	}
+}
+
+func TestSagaCancelledBeforeStep(t *testing.T) {
+	db := newTestDriver(t, nil)
+	saga, log := recordingSaga(t, db, "", "")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := saga.Execute(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Execute = %v, want context.Canceled", err)
+	}
+	if len(*log) != 0 {
+		t.Fatalf("ran %v after cancel", *log)
+	}
+}
+
+func TestSagaRecordsProgress(t *testing.T) {
+	db := newTestDriver(t, nil)
+	saga, err := NewSaga(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var seen SagaState
+	saga.AddStep("a", func(*Driver) error { return nil }, nil)
+	saga.AddStep("b", func(d *Driver) error {
+		seen = sagaState(t, d, saga.ID())
+		return nil
+	}, nil)
+	if err := saga.Execute(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if seen.Status != SagaRunning || seen.Completed != 1 || !reflect.DeepEqual(seen.Steps, []string{"a", "b"}) {
+		t.Fatalf("state during step b = %+v, want running with a completed", seen)
+	}
+}
+
+func TestPendingSagasAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	db, err := New(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Leave behind the state of a saga whose process died after step a,
+	// and of one that finished.
+	interrupted := SagaState{ID: "01", Steps: []string{"a", "b"}, Completed: 1, Status: SagaRunning, Updated: time.Now().UTC()}
+	done := SagaState{ID: "02", Steps: []string{"a"}, Completed: 1, Status: SagaCompleted, Updated: time.Now().UTC()}
+	for _, state := range []SagaState{interrupted, done} {
+		b, _ := json.Marshal(state)
+		if err := db.write(sagasCollection, state.ID, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	db, err = New(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	pending, err := db.PendingSagas()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].ID != "01" || pending[0].Completed != 1 || pending[0].Status != SagaRunning {
+		t.Fatalf("PendingSagas = %+v, want the interrupted saga", pending)
+	}
+}
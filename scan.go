@@ -0,0 +1,97 @@
+package main
+
+import "context"
+
+// scanResult is one record read by a scan worker.
+type scanResult struct {
+	b   []byte
+	err error
+}
+
+// scanFiles reads the named records of a collection and calls fn with each
+// in order. With Options.ScanConcurrency above 1, up to that many files are
+// read ahead in parallel; fn still runs on the calling goroutine, one record
+// at a time. The first error, or ctx being done, stops the scan, and reads
+// not yet started are abandoned.
+func (d *Driver) scanFiles(ctx context.Context, collection string, resources []string, fn func(resource string, b []byte) error) error {
+	if d.scanConcurrency <= 1 {
+		for _, resource := range resources {
+			b, err := d.readFileContext(ctx, d.recordPath(collection, resource))
+			if err != nil {
+				return err
+			}
+
+			if err := fn(resource, b); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Each pending read gets a slot; the consumer holds one and the rest
+	// wait in the channel, so at most scanConcurrency files are in memory.
+	slots := make(chan chan scanResult, d.scanConcurrency-1)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go func() {
+		defer close(slots)
+		for _, resource := range resources {
+			slot := make(chan scanResult, 1)
+			select {
+			case slots <- slot:
+			case <-stop:
+				return
+			}
+
+			go func(path string) {
+				b, err := d.readFile(path)
+				slot <- scanResult{b, err}
+			}(d.recordPath(collection, resource))
+		}
+	}()
+
+	for _, resource := range resources {
+		slot := <-slots
+
+		var result scanResult
+		select {
+		case result = <-slot:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if result.err != nil {
+			return result.err
+		}
+
+		if err := fn(resource, result.b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readFileContext is readFile returning ctx.Err() as soon as ctx is done,
+// even if the read itself is blocked.
+func (d *Driver) readFileContext(ctx context.Context, path string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if ctx.Done() == nil {
+		return d.readFile(path)
+	}
+
+	done := make(chan scanResult, 1)
+	go func() {
+		b, err := d.readFile(path)
+		done <- scanResult{b, err}
+	}()
+
+	select {
+	case result := <-done:
+		return result.b, result.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
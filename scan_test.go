@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func writeNumbered(tb testing.TB, db *Driver, n int) {
+	tb.Helper()
+	for i := 0; i < n; i++ {
+		if err := db.Write("users", fmt.Sprintf("%05d", i), map[string]int{"n": i}); err != nil {
+			tb.Fatal(err)
+		}
+	}
+}
+
+func TestScanConcurrencyKeepsOrder(t *testing.T) {
+	var want []KeyedRecord
+	for _, concurrency := range []int{1, 4, 16} {
+		db := newTestDriver(t, &Options{ScanConcurrency: concurrency})
+		writeNumbered(t, db, 200)
+
+		records, err := db.ReadAllWithKeys("users")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 200 {
+			t.Fatalf("concurrency %d: %d records, want 200", concurrency, len(records))
+		}
+		for i, r := range records {
+			if r.Key != fmt.Sprintf("%05d", i) {
+				t.Fatalf("concurrency %d: record %d is %s", concurrency, i, r.Key)
+			}
+		}
+		if want == nil {
+			want = records
+		} else if !reflect.DeepEqual(records, want) {
+			t.Fatalf("concurrency %d: records differ from a sequential scan", concurrency)
+		}
+	}
+}
+
+func TestScanConcurrencyFirstErrorWins(t *testing.T) {
+	db := newTestDriver(t, &Options{ScanConcurrency: 8})
+	writeNumbered(t, db, 100)
+
+	stop := errors.New("stop")
+	calls := 0
+	err := db.ForEach("users", func(resource string, b []byte) error {
+		calls++
+		if resource == "00010" {
+			return stop
+		}
+		return nil
+	})
+	if err != stop {
+		t.Fatalf("ForEach = %v, want the callback's error", err)
+	}
+	if calls != 11 {
+		t.Fatalf("callback ran %d times, want 11", calls)
+	}
+
+	// A decode error stops a query scan the same way.
+	writeOutside(t, db, "users", "00050", "{")
+	if _, err := db.GroupBy("users", "n"); err == nil {
+		t.Fatal("GroupBy over a malformed record succeeded")
+	}
+}
+
+func TestScanConcurrencyCancel(t *testing.T) {
+	db := newTestDriver(t, &Options{ScanConcurrency: 4})
+	writeNumbered(t, db, 50)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := db.ReadAllContext(ctx, "users"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("ReadAllContext with a canceled context = %v, want context.Canceled", err)
+	}
+}
+
+func BenchmarkReadAllConcurrency(b *testing.B) {
+	for _, concurrency := range []int{1, 4, 16} {
+		b.Run(fmt.Sprint(concurrency), func(b *testing.B) {
+			db := newTestDriver(b, &Options{ScanConcurrency: concurrency})
+			writeNumbered(b, db, 2000)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := db.ReadAll("users"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestReadAllContextDeadlineOnStuckFile reads a collection holding a FIFO,
+// whose open blocks until a writer shows up, like a file on a hung mount.
+func TestReadAllContextDeadlineOnStuckFile(t *testing.T) {
+	for _, concurrency := range []int{1, 4} {
+		db := newTestDriver(t, &Options{ScanConcurrency: concurrency})
+		writeNumbered(t, db, 5)
+
+		stuck := db.recordPath("users", "00002")
+		os.Remove(stuck)
+		if err := syscall.Mkfifo(stuck, 0644); err != nil {
+			t.Skip("mkfifo:", err)
+		}
+		// Let the abandoned read finish once the test is done.
+		defer func() {
+			if f, err := os.OpenFile(stuck, os.O_WRONLY|syscall.O_NONBLOCK, 0); err == nil {
+				f.Close()
+			}
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		start := time.Now()
+		var err error
+		within(t, time.Second, func() {
+			_, err = db.ReadAllContext(ctx, "users")
+		})
+		cancel()
+
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("concurrency %d: ReadAllContext = %v, want context.DeadlineExceeded", concurrency, err)
+		}
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Fatalf("concurrency %d: returned after %v, long past the deadline", concurrency, elapsed)
+		}
+	}
+}
+
+func TestQueryStreamDeadlineOnStuckFile(t *testing.T) {
+	db := newTestDriver(t, nil)
+	writeNumbered(t, db, 5)
+
+	stuck := db.recordPath("users", "00002")
+	os.Remove(stuck)
+	if err := syscall.Mkfifo(stuck, 0644); err != nil {
+		t.Skip("mkfifo:", err)
+	}
+	defer func() {
+		if f, err := os.OpenFile(stuck, os.O_WRONLY|syscall.O_NONBLOCK, 0); err == nil {
+			f.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	records, errc := db.QueryStream(ctx, "users", func(json.RawMessage) (bool, error) { return true, nil })
+
+	var err error
+	within(t, time.Second, func() {
+		for range records {
+		}
+		err = <-errc
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("QueryStream = %v, want context.DeadlineExceeded", err)
+	}
+}
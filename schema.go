@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// inferredSchema is a collection's schema as learned by FlexibleSchema. It
+// is stored in the collection directory as _schema.json, maps each
+// top-level field to its JSON type, and lists fields seen with more than
+// one type.
+type inferredSchema struct {
+	Locked    bool                `json:"locked"`
+	Fields    map[string]string   `json:"fields"`
+	Conflicts map[string][]string `json:"conflicts,omitempty"`
+}
+
+// InferredSchema returns the field types learned for a collection so far.
+func (d *Driver) InferredSchema(collection string) (map[string]string, error) {
+	collection, _, err := d.transformKeys(collection, "")
+	if err != nil {
+		return nil, err
+	}
+
+	mutex := d.getOrCreateMutex(collection)
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	schema, err := d.loadSchema(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]string, len(schema.Fields))
+	for name, typ := range schema.Fields {
+		fields[name] = typ
+	}
+	return fields, nil
+}
+
+// LockSchema freezes a collection's inferred schema. From then on Write
+// rejects records with fields the schema has not seen or with values of a
+// different type, whether or not FlexibleSchema is still set.
+func (d *Driver) LockSchema(collection string) error {
+	collection, _, err := d.transformKeys(collection, "")
+	if err != nil {
+		return err
+	}
+
+	if collection == "" {
+		return ErrMissingCollection
+	}
+
+	mutex, err := d.lockCollection(collection)
+	if err != nil {
+		return err
+	}
+	defer mutex.Unlock()
+
+	schema, err := d.loadSchema(collection)
+	if err != nil {
+		return err
+	}
+
+	locked := schema.clone()
+	locked.Locked = true
+	if err := d.saveSchema(collection, locked); err != nil {
+		return err
+	}
+
+	d.mutex.Lock()
+	d.schemas[collection] = locked
+	d.mutex.Unlock()
+	return nil
+}
+
+// checkSchema validates a marshaled record against a locked schema. The
+// schema is not changed; learnSchema extends it once the record is stored.
+// Callers must hold the collection mutex.
+func (d *Driver) checkSchema(collection string, b []byte) error {
+	schema, err := d.loadSchema(collection)
+	if err != nil {
+		return err
+	}
+
+	if !schema.Locked {
+		return nil
+	}
+
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return fmt.Errorf("Schema violation- records in %s must be objects", collection)
+	}
+
+	names := make([]string, 0, len(doc))
+	for name := range doc {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		typ := jsonType(doc[name])
+		known, ok := schema.Fields[name]
+
+		switch {
+		case !ok:
+			return fmt.Errorf("Schema violation- unknown field %s in %s", name, collection)
+		case typ == "null" || typ == known || known == "null":
+		default:
+			return fmt.Errorf("Schema violation- field %s in %s must be %s, not %s", name, collection, known, typ)
+		}
+	}
+	return nil
+}
+
+// learnSchema extends a collection's schema with the fields of a record
+// written after checkSchema accepted it: with FlexibleSchema new fields and
+// type conflicts are recorded, and a locked schema learns the type of a
+// field so far only seen as null. The cached schema is replaced only once
+// the extended copy is saved. Callers must hold the collection mutex.
+func (d *Driver) learnSchema(collection string, b []byte) error {
+	schema, err := d.loadSchema(collection)
+	if err != nil {
+		return err
+	}
+
+	if !schema.Locked && !d.flexibleSchema {
+		return nil
+	}
+
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(doc))
+	for name := range doc {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	next := schema.clone()
+	changed := false
+	for _, name := range names {
+		typ := jsonType(doc[name])
+		known, ok := next.Fields[name]
+
+		switch {
+		case !ok && next.Locked:
+		case !ok:
+			next.Fields[name] = typ
+			changed = true
+		case typ == "null" || typ == known:
+		case known == "null":
+			next.Fields[name] = typ
+			changed = true
+		case next.Locked:
+		default:
+			if !contains(next.Conflicts[name], typ) {
+				d.logger.Warn("Type conflict for %s.%s: %s and %s", collection, name, known, typ)
+				next.Conflicts[name] = append(next.Conflicts[name], typ)
+				changed = true
+			}
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+	if err := d.saveSchema(collection, next); err != nil {
+		return err
+	}
+
+	d.mutex.Lock()
+	d.schemas[collection] = next
+	d.mutex.Unlock()
+	return nil
+}
+
+func (s *inferredSchema) clone() *inferredSchema {
+	c := &inferredSchema{
+		Locked:    s.Locked,
+		Fields:    make(map[string]string, len(s.Fields)),
+		Conflicts: make(map[string][]string, len(s.Conflicts)),
+	}
+	for name, typ := range s.Fields {
+		c.Fields[name] = typ
+	}
+	for name, types := range s.Conflicts {
+		c.Conflicts[name] = append([]string(nil), types...)
+	}
+	return c
+}
+
+// loadSchema returns the cached schema of a collection, reading it from disk
+// the first time. Callers must hold the collection mutex.
+func (d *Driver) loadSchema(collection string) (*inferredSchema, error) {
+	d.mutex.Lock()
+	schema, ok := d.schemas[collection]
+	d.mutex.Unlock()
+	if ok {
+		return schema, nil
+	}
+
+	schema = &inferredSchema{}
+	b, err := d.readFile(d.schemaPath(collection))
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(b, schema); err != nil {
+			return nil, fmt.Errorf("Corrupt schema- %s: %v", collection, err)
+		}
+	}
+
+	if schema.Fields == nil {
+		schema.Fields = make(map[string]string)
+	}
+	if schema.Conflicts == nil {
+		schema.Conflicts = make(map[string][]string)
+	}
+
+	d.mutex.Lock()
+	d.schemas[collection] = schema
+	d.mutex.Unlock()
+	return schema, nil
+}
+
+func (d *Driver) saveSchema(collection string, schema *inferredSchema) error {
+	b, err := json.MarshalIndent(schema, "", "\t")
+	if err != nil {
+		return err
+	}
+	return d.writeFile(d.schemaPath(collection), append(b, byte('\n')))
+}
+
+func (d *Driver) schemaPath(collection string) string {
+	return filepath.Join(d.dir, collection, "_schema.json")
+}
+
+// jsonType names the JSON type of a raw value.
+func jsonType(raw json.RawMessage) string {
+	for _, c := range raw {
+		switch c {
+		case ' ', '\t', '\r', '\n':
+			continue
+		case '{':
+			return "object"
+		case '[':
+			return "array"
+		case '"':
+			return "string"
+		case 't', 'f':
+			return "boolean"
+		case 'n':
+			return "null"
+		}
+		return "number"
+	}
+	return "null"
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func expectSchema(t *testing.T, db *Driver, want map[string]string) {
+	t.Helper()
+	got, err := db.InferredSchema("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("InferredSchema = %v, want %v", got, want)
+	}
+}
+
+func TestFlexibleSchemaAcceptsTypeChange(t *testing.T) {
+	db := newTestDriver(t, &Options{FlexibleSchema: true})
+	if err := db.Write("users", "john", map[string]interface{}{"name": "john", "age": 25, "nick": nil}); err != nil {
+		t.Fatal(err)
+	}
+	expectSchema(t, db, map[string]string{"name": "string", "age": "number", "nick": "null"})
+
+	if err := db.Write("users", "jane", map[string]interface{}{"name": "jane", "age": "thirty", "nick": "jj"}); err != nil {
+		t.Fatalf("flexible schema rejected a type change: %v", err)
+	}
+	// The first type seen stays; a null field learns its type.
+	expectSchema(t, db, map[string]string{"name": "string", "age": "number", "nick": "string"})
+}
+
+func TestLockSchemaRejectsChanges(t *testing.T) {
+	dir := t.TempDir()
+	db, err := New(dir, &Options{FlexibleSchema: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Write("users", "john", map[string]interface{}{"name": "john", "age": 25, "nick": nil})
+	if err := db.LockSchema("users"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// The lock is stored, and holds without FlexibleSchema.
+	db, err = New(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for name, record := range map[string]interface{}{
+		"type change":   map[string]interface{}{"name": "jane", "age": "thirty"},
+		"unknown field": map[string]interface{}{"name": "jane", "email": "j@x"},
+		"not an object": []int{1},
+	} {
+		if err := db.Write("users", "jane", record); err == nil {
+			t.Errorf("locked schema accepted a %s", name)
+		}
+	}
+	if _, err := os.Stat(db.recordPath("users", "jane")); !os.IsNotExist(err) {
+		t.Fatalf("rejected record was stored: %v", err)
+	}
+
+	if err := db.Write("users", "jane", map[string]interface{}{"name": "jane", "nick": "jj"}); err != nil {
+		t.Fatalf("locked schema rejected a matching record: %v", err)
+	}
+	expectSchema(t, db, map[string]string{"name": "string", "age": "number", "nick": "string"})
+}
+
+func TestFailedWriteLeavesSchema(t *testing.T) {
+	db := newTestDriver(t, &Options{FlexibleSchema: true})
+	db.Write("users", "john", map[string]interface{}{"name": "john"})
+	db.SetRequiredFields("users", []string{"name"})
+
+	if err := db.Write("users", "jane", map[string]interface{}{"email": "j@x"}); err == nil {
+		t.Fatal("Write without a required field succeeded")
+	}
+
+	// A directory in the record's place makes the rename fail.
+	if err := os.MkdirAll(db.recordPath("users", "jim")+"/blocker", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Write("users", "jim", map[string]interface{}{"name": "jim", "age": 40}); err == nil {
+		t.Fatal("Write over a directory succeeded")
+	}
+
+	expectSchema(t, db, map[string]string{"name": "string"})
+}
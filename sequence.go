@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const sequenceDir = ".sequences"
+
+type sequence struct {
+	mutex   sync.Mutex
+	loaded  bool
+	current uint64 // last value handed out
+	limit   uint64 // highest value reserved on disk
+}
+
+// NextSequence returns the next value of a named sequence, starting at 1.
+// Values are strictly increasing and never repeat, even across restarts.
+func (d *Driver) NextSequence(name string) (uint64, error) {
+	seq, err := d.getOrLoadSequence(name)
+	if err != nil {
+		return 0, err
+	}
+	defer seq.mutex.Unlock()
+
+	if seq.current == seq.limit {
+		limit := seq.limit + d.sequenceBatch
+		if err := d.writeSequence(name, limit); err != nil {
+			return 0, err
+		}
+		seq.limit = limit
+	}
+
+	seq.current++
+	return seq.current, nil
+}
+
+// CurrentSequence returns the last value handed out by NextSequence, or 0 if
+// the sequence has never been used. After a restart with SequenceBatch > 1
+// this is the end of the last reserved range.
+func (d *Driver) CurrentSequence(name string) (uint64, error) {
+	seq, err := d.getOrLoadSequence(name)
+	if err != nil {
+		return 0, err
+	}
+	defer seq.mutex.Unlock()
+
+	return seq.current, nil
+}
+
+// getOrLoadSequence returns the named sequence locked and loaded from disk.
+func (d *Driver) getOrLoadSequence(name string) (*sequence, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return nil, fmt.Errorf("Invalid sequence- %q is not a valid sequence name", name)
+	}
+
+	d.mutex.Lock()
+	seq, ok := d.sequences[name]
+	if !ok {
+		seq = &sequence{}
+		d.sequences[name] = seq
+	}
+	d.mutex.Unlock()
+
+	seq.mutex.Lock()
+	if seq.loaded {
+		return seq, nil
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(d.dir, sequenceDir, name))
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		seq.mutex.Unlock()
+		return nil, err
+	default:
+		limit, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+		if err != nil {
+			seq.mutex.Unlock()
+			return nil, fmt.Errorf("Corrupt sequence- %s: %v", name, err)
+		}
+		seq.current, seq.limit = limit, limit
+	}
+
+	seq.loaded = true
+	return seq, nil
+}
+
+// writeSequence durably records limit as the highest reserved value.
+func (d *Driver) writeSequence(name string, limit uint64) error {
+	dir := filepath.Join(d.dir, sequenceDir)
+	fnlPath := filepath.Join(dir, name)
+	tempPath := fnlPath + ".tmp"
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(tempPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.WriteString(strconv.FormatUint(limit, 10) + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tempPath, fnlPath); err != nil {
+		return err
+	}
+
+	return fsync(dir)
+}
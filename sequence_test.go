@@ -0,0 +1,110 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"testing"
+)
+
+// drawConcurrently draws n values from a sequence in each of g goroutines
+// and returns them sorted.
+func drawConcurrently(t *testing.T, db *Driver, name string, g, n int) []uint64 {
+	t.Helper()
+	var (
+		mutex  sync.Mutex
+		values []uint64
+		wg     sync.WaitGroup
+	)
+	for i := 0; i < g; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var last uint64
+			for j := 0; j < n; j++ {
+				v, err := db.NextSequence(name)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if v <= last {
+					t.Errorf("NextSequence = %d after %d in one goroutine", v, last)
+				}
+				last = v
+				mutex.Lock()
+				values = append(values, v)
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	return values
+}
+
+func TestSequenceStress(t *testing.T) {
+	for _, batch := range []uint64{1, 7} {
+		db := newTestDriver(t, &Options{SequenceBatch: batch})
+
+		const goroutines, draws = 16, 200
+		values := drawConcurrently(t, db, "invoices", goroutines, draws)
+		if len(values) != goroutines*draws {
+			t.Fatalf("batch %d: drew %d values, want %d", batch, len(values), goroutines*draws)
+		}
+		// Within one run nothing is burned, so the values are exactly 1..N.
+		for i, v := range values {
+			if v != uint64(i+1) {
+				t.Fatalf("batch %d: value %d is %d, want %d: repeated or skipped", batch, i, v, i+1)
+			}
+		}
+
+		if current, err := db.CurrentSequence("invoices"); err != nil || current != goroutines*draws {
+			t.Fatalf("batch %d: CurrentSequence = %d, %v, want %d", batch, current, err, goroutines*draws)
+		}
+	}
+}
+
+func TestSequenceBatchSkipsReservedAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	db, err := New(dir, &Options{SequenceBatch: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		db.NextSequence("tickets")
+	}
+	db.Close()
+
+	db, err = New(dir, &Options{SequenceBatch: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// 4 to 10 were reserved before the restart and are burned, not reused.
+	if v, err := db.NextSequence("tickets"); err != nil || v != 11 {
+		t.Fatalf("NextSequence after restart = %d, %v, want 11", v, err)
+	}
+}
+
+func TestSequencesAreIndependent(t *testing.T) {
+	db := newTestDriver(t, nil)
+	db.NextSequence("a")
+	db.NextSequence("a")
+
+	if v, _ := db.NextSequence("b"); v != 1 {
+		t.Fatalf("first value of b = %d, want 1", v)
+	}
+	if v, _ := db.CurrentSequence("a"); v != 2 {
+		t.Fatalf("CurrentSequence(a) = %d, want 2", v)
+	}
+}
+
+func TestSequenceRejectsInvalidNames(t *testing.T) {
+	db := newTestDriver(t, nil)
+	for _, name := range []string{"", "a/b", `a\b`} {
+		if _, err := db.NextSequence(name); err == nil {
+			t.Errorf("NextSequence(%q) succeeded", name)
+		}
+	}
+}
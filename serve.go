@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+)
+
+// ServeRecord writes a record to w using http.ServeContent, so conditional
+// (If-Modified-Since) and Range requests are handled. It returns ErrNotFound
+// without writing a response if the record does not exist, letting the
+// caller choose how to 404.
+func (d *Driver) ServeRecord(w http.ResponseWriter, r *http.Request, collection, resource string) error {
+	collection, resource, err := d.transformKeys(collection, resource)
+	if err != nil {
+		return err
+	}
+
+	if collection == "" {
+		return ErrMissingCollection
+	}
+
+	if resource == "" {
+		return ErrMissingResource
+	}
+
+	if err := d.checkFrozen(collection); err != nil {
+		return err
+	}
+
+	path := d.recordPath(collection, resource)
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	// Headered records are served without their length header.
+	var content io.ReadSeeker = f
+	var first [1]byte
+	if n, _ := f.Read(first[:]); n == 1 && first[0] == lengthHeaderPrefix {
+		b, err := d.readFile(path)
+		if err != nil {
+			return err
+		}
+		content = bytes.NewReader(b)
+	} else if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	http.ServeContent(w, r, resource+".json", fi.ModTime(), content)
+	return nil
+}
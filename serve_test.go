@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func serve(t *testing.T, db *Driver, header http.Header) (*httptest.ResponseRecorder, error) {
+	t.Helper()
+	r := httptest.NewRequest("GET", "/users/john", nil)
+	for k, v := range header {
+		r.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	return w, db.ServeRecord(w, r, "users", "john")
+}
+
+func TestServeRecordRange(t *testing.T) {
+	for _, lengthHeader := range []bool{false, true} {
+		db := newTestDriver(t, &Options{LengthHeader: lengthHeader})
+		db.Write("users", "john", benchUser)
+		content, err := db.readFile(db.recordPath("users", "john"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w, err := serve(t, db, http.Header{"Range": {"bytes=2-9"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w.Code != http.StatusPartialContent {
+			t.Fatalf("status = %d, want 206", w.Code)
+		}
+		if got, want := w.Body.String(), string(content[2:10]); got != want {
+			t.Fatalf("LengthHeader %v: body = %q, want %q", lengthHeader, got, want)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+			t.Fatalf("Content-Type = %q, want application/json", ct)
+		}
+	}
+}
+
+func TestServeRecordWhole(t *testing.T) {
+	db := newTestDriver(t, nil)
+	db.Write("users", "john", benchUser)
+	content, _ := os.ReadFile(db.recordPath("users", "john"))
+
+	w, err := serve(t, db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || w.Body.String() != string(content) {
+		t.Fatalf("status %d, body %q; want 200 with the record", w.Code, w.Body.String())
+	}
+}
+
+func TestServeRecordNotModified(t *testing.T) {
+	db := newTestDriver(t, nil)
+	db.Write("users", "john", benchUser)
+
+	since := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	w, err := serve(t, db, http.Header{"If-Modified-Since": {since}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("status = %d, want 304", w.Code)
+	}
+}
+
+func TestServeRecordNotFound(t *testing.T) {
+	db := newTestDriver(t, nil)
+
+	w, err := serve(t, db, nil)
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("ServeRecord of a missing record = %v, want ErrNotFound", err)
+	}
+	if w.Body.Len() != 0 {
+		t.Fatalf("wrote %q for a missing record", w.Body.String())
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// recordDataFile holds a record's data when Options.RecordDirs is set. The
+// record's sidecars live next to it as <name>.json.
+const recordDataFile = "data.json"
+
+// SetSidecar stores v as named metadata (e.g. "tags" or "acl") alongside an
+// existing record. It requires Options.RecordDirs and is removed along with
+// the record by Delete.
+func (d *Driver) SetSidecar(collection, resource, name string, v interface{}) error {
+	collection, resource, err := d.transformKeys(collection, resource)
+	if err != nil {
+		return err
+	}
+
+	path, err := d.sidecarPath(collection, resource, name)
+	if err != nil {
+		return err
+	}
+
+	mutex, err := d.lockWritable(collection)
+	if err != nil {
+		return err
+	}
+	defer mutex.Unlock()
+
+	if _, err := os.Stat(d.recordPath(collection, resource)); os.IsNotExist(err) {
+		return ErrNotFound
+	}
+
+	b, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return d.writeFile(path, append(b, byte('\n')))
+}
+
+// GetSidecar reads named metadata stored with SetSidecar into v.
+func (d *Driver) GetSidecar(collection, resource, name string, v interface{}) error {
+	collection, resource, err := d.transformKeys(collection, resource)
+	if err != nil {
+		return err
+	}
+
+	path, err := d.sidecarPath(collection, resource, name)
+	if err != nil {
+		return err
+	}
+
+	b, err := d.readFile(path)
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(b, v); err != nil {
+		decodeErr := d.decodeError(collection, resource, b, err).(*DecodeError)
+		decodeErr.Path = path
+		return decodeErr
+	}
+	return nil
+}
+
+// sidecarPath expects collection and resource already passed through
+// transformKeys.
+func (d *Driver) sidecarPath(collection, resource, name string) (string, error) {
+	if !d.recordDirs {
+		return "", fmt.Errorf("Sidecars unavailable- enable Options.RecordDirs")
+	}
+
+	if collection == "" {
+		return "", ErrMissingCollection
+	}
+
+	if resource == "" {
+		return "", ErrMissingResource
+	}
+
+	if err := d.checkFrozen(collection); err != nil {
+		return "", err
+	}
+
+	file := name + ".json"
+	if name == "" || file == recordDataFile || filepath.Base(file) != file {
+		return "", fmt.Errorf("Invalid sidecar- %q is not a valid sidecar name", name)
+	}
+
+	return filepath.Join(d.dir, collection, resource, file), nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRecordDirsWithSidecar(t *testing.T) {
+	db := newTestDriver(t, &Options{RecordDirs: true})
+	if err := db.Write("users", "john", benchUser); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(db.Dir(), "users", "john", recordDataFile)); err != nil {
+		t.Fatalf("record not stored as a directory: %v", err)
+	}
+
+	tags := []string{"admin", "beta"}
+	if err := db.SetSidecar("users", "john", "tags", tags); err != nil {
+		t.Fatal(err)
+	}
+
+	var user User
+	if err := db.Read("users", "john", &user); err != nil || !reflect.DeepEqual(user, benchUser) {
+		t.Fatalf("Read = %+v, %v", user, err)
+	}
+	var got []string
+	if err := db.GetSidecar("users", "john", "tags", &got); err != nil || !reflect.DeepEqual(got, tags) {
+		t.Fatalf("GetSidecar = %v, %v, want %v", got, err, tags)
+	}
+
+	records, err := db.ReadAll("users")
+	if err != nil || len(records) != 1 {
+		t.Fatalf("ReadAll = %d records, %v; want the record without its sidecar", len(records), err)
+	}
+
+	if err := db.Delete("users", "john"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(db.Dir(), "users", "john")); !os.IsNotExist(err) {
+		t.Fatalf("record directory left after Delete: %v", err)
+	}
+}
+
+func TestSidecarErrors(t *testing.T) {
+	db := newTestDriver(t, &Options{RecordDirs: true})
+	db.Write("users", "john", benchUser)
+
+	if err := db.SetSidecar("users", "nobody", "tags", []string{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("SetSidecar on a missing record = %v, want ErrNotFound", err)
+	}
+	if err := db.GetSidecar("users", "john", "acl", &[]string{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetSidecar of a missing sidecar = %v, want ErrNotFound", err)
+	}
+	for _, name := range []string{"", "data", "../x"} {
+		if err := db.SetSidecar("users", "john", name, 1); err == nil {
+			t.Errorf("SetSidecar(%q) succeeded", name)
+		}
+	}
+
+	flat := newTestDriver(t, nil)
+	flat.Write("users", "john", benchUser)
+	if err := flat.SetSidecar("users", "john", "tags", []string{}); err == nil {
+		t.Error("SetSidecar without RecordDirs succeeded")
+	}
+}
+
+func TestSidecarWithKeyTransformer(t *testing.T) {
+	db := newTestDriver(t, &Options{RecordDirs: true, KeyTransformer: strings.ToLower, TransformCollections: true})
+	if err := db.Write("Users", "John", benchUser); err != nil {
+		t.Fatal(err)
+	}
+
+	tags := []string{"admin"}
+	if err := db.SetSidecar("Users", "John", "tags", tags); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	if err := db.GetSidecar("users", "JOHN", "tags", &got); err != nil || !reflect.DeepEqual(got, tags) {
+		t.Fatalf("GetSidecar = %v, %v, want %v", got, err, tags)
+	}
+	if _, err := os.Stat(filepath.Join(db.Dir(), "users", "john", "tags.json")); err != nil {
+		t.Fatalf("sidecar not stored under the transformed names: %v", err)
+	}
+}
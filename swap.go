@@ -0,0 +1,349 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// swapMarker records an in-progress Swap so it can be resolved after a crash.
+// It lives in the collection directory as .swap.json.
+const swapMarker = ".swap.json"
+
+type swapState struct {
+	A string `json:"a"`
+	B string `json:"b"`
+	// Attachments is the attachment rename being made, from 1 to 3, once
+	// the attachments started moving.
+	Attachments int `json:"attachments,omitempty"`
+}
+
+// Swap atomically exchanges the contents of two records, attachments
+// included. The exchange is three renames through a temporary name, with
+// the attachments moved the same way in between; if the process dies part
+// way, the next New restores either the original or the swapped state.
+func (d *Driver) Swap(collection, resourceA, resourceB string) error {
+	collection, resourceA, err := d.transformKeys(collection, resourceA)
+	if err != nil {
+		return err
+	}
+
+	if _, resourceB, err = d.transformKeys("", resourceB); err != nil {
+		return err
+	}
+
+	if collection == "" {
+		return ErrMissingCollection
+	}
+
+	if resourceA == "" || resourceB == "" {
+		return ErrMissingResource
+	}
+
+	if resourceA == resourceB {
+		return nil
+	}
+
+	mutex, err := d.lockMutable(collection)
+	if err != nil {
+		return err
+	}
+	defer mutex.Unlock()
+
+	pathA := d.recordLocation(collection, resourceA)
+	pathB := d.recordLocation(collection, resourceB)
+	for _, path := range []string{pathA, pathB} {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return ErrNotFound
+		}
+	}
+
+	state := swapState{A: resourceA, B: resourceB}
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	beforeA, tracked := d.previousVersion(collection, resourceA)
+	beforeB, _ := d.previousVersion(collection, resourceB)
+
+	marker := filepath.Join(d.dir, collection, swapMarker)
+	if err := d.writeFile(marker, b); err != nil {
+		return err
+	}
+
+	tempPath := swapTempPath(pathA)
+	if err := os.Rename(pathA, tempPath); err != nil {
+		os.Remove(marker)
+		return err
+	}
+
+	// Once the attachments start moving the swap can only go forward; if a
+	// rename fails the marker stays, for the next New to finish it.
+	if d.hasAttachments(collection, resourceA) || d.hasAttachments(collection, resourceB) {
+		if err := d.swapAttachments(collection, marker, &state); err != nil {
+			return err
+		}
+		if err := os.Rename(pathB, pathA); err != nil {
+			return err
+		}
+	} else if err := os.Rename(pathB, pathA); err != nil {
+		os.Rename(tempPath, pathA)
+		os.Remove(marker)
+		return err
+	}
+
+	if err := os.Rename(tempPath, pathB); err != nil {
+		return err
+	}
+
+	d.recordModified(collection, resourceA, false)
+	d.recordModified(collection, resourceB, false)
+	d.recordChange(collection, resourceA, tracked, beforeA, beforeB)
+	d.recordChange(collection, resourceB, tracked, beforeB, beforeA)
+	for _, resource := range []string{resourceA, resourceB} {
+		if b, err := d.readFile(d.recordPath(collection, resource)); err == nil {
+			d.updateIndexes(collection, resource, b)
+		}
+	}
+	d.scheduleSync(filepath.Dir(pathA))
+	return os.Remove(marker)
+}
+
+// Promote atomically replaces dst with a copy of src.
+func (d *Driver) Promote(collection, src, dst string) error {
+	collection, src, err := d.transformKeys(collection, src)
+	if err != nil {
+		return err
+	}
+
+	if _, dst, err = d.transformKeys("", dst); err != nil {
+		return err
+	}
+
+	if collection == "" {
+		return ErrMissingCollection
+	}
+
+	if src == "" || dst == "" {
+		return ErrMissingResource
+	}
+
+	mutex, err := d.lockWritable(collection)
+	if err != nil {
+		return err
+	}
+	defer mutex.Unlock()
+
+	if err := d.checkInsert(collection, d.recordPath(collection, dst)); err != nil {
+		return err
+	}
+
+	b, err := d.readFile(d.recordPath(collection, src))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	// Copy the attachments aside first, so a failed copy changes nothing.
+	dstAttachments := d.attachmentsPath(collection, dst)
+	staged := filepath.Join(filepath.Dir(dstAttachments), "."+filepath.Base(dstAttachments)+".promote")
+	if err := os.RemoveAll(staged); err != nil {
+		return err
+	}
+	if d.hasAttachments(collection, src) {
+		if err := copyAttachments(d.attachmentsPath(collection, src), staged); err != nil {
+			os.RemoveAll(staged)
+			return err
+		}
+	}
+
+	if err := d.write(collection, dst, b); err != nil {
+		os.RemoveAll(staged)
+		return err
+	}
+
+	if err := d.removeAttachments(collection, dst); err != nil {
+		return err
+	}
+	if _, err := os.Stat(staged); err == nil {
+		if err := os.Rename(staged, dstAttachments); err != nil {
+			return err
+		}
+	}
+	d.scheduleSync(filepath.Dir(dstAttachments))
+	return nil
+}
+
+// copyAttachments copies the attachment files in dir to a new directory.
+func copyAttachments(dir, to string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(to, 0755); err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		// Skip uploads in progress.
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+		if err := copyFile(filepath.Join(dir, file.Name()), filepath.Join(to, file.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyFile(from, to string) error {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dst, src)
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// swapAttachments exchanges the attachments of the records of a Swap, in
+// three renames through a temporary name, starting from state.Attachments.
+// The marker is rewritten before each rename. A rename whose source is gone
+// has already been made, so an interrupted swap can be resumed from the
+// marker.
+func (d *Driver) swapAttachments(collection, marker string, state *swapState) error {
+	pathA := d.attachmentsPath(collection, state.A)
+	pathB := d.attachmentsPath(collection, state.B)
+	tempPath := swapTempPath(pathA)
+	renames := [][2]string{{pathA, tempPath}, {pathB, pathA}, {tempPath, pathB}}
+
+	if state.Attachments == 0 {
+		state.Attachments = 1
+	}
+	for ; state.Attachments <= len(renames); state.Attachments++ {
+		b, err := json.Marshal(state)
+		if err != nil {
+			return err
+		}
+		if err := d.writeFile(marker, b); err != nil {
+			return err
+		}
+
+		from, to := renames[state.Attachments-1][0], renames[state.Attachments-1][1]
+		if _, err := os.Stat(from); os.IsNotExist(err) {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(from, to); err != nil {
+			return err
+		}
+	}
+
+	d.scheduleSync(filepath.Dir(pathA), filepath.Dir(pathB))
+	return nil
+}
+
+// recordLocation is what Swap renames: the record file, or the whole record
+// directory (sidecars included) with Options.RecordDirs.
+func (d *Driver) recordLocation(collection, resource string) string {
+	if d.recordDirs {
+		return filepath.Join(d.dir, collection, resource)
+	}
+	return d.recordPath(collection, resource)
+}
+
+func swapTempPath(path string) string {
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".swap")
+}
+
+// recoverSwaps finishes or rolls back any Swap interrupted by a crash. With
+// A moved aside and B not yet in its place, A is put back; once B has taken
+// A's place, the swap is completed.
+func (d *Driver) recoverSwaps() error {
+	files, err := ioutil.ReadDir(d.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if !file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+
+		collection := file.Name()
+		marker := filepath.Join(d.dir, collection, swapMarker)
+		b, err := d.readFile(marker)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		var state swapState
+		if err := json.Unmarshal(b, &state); err != nil {
+			return err
+		}
+
+		pathA := d.recordLocation(collection, state.A)
+		pathB := d.recordLocation(collection, state.B)
+		tempPath := swapTempPath(pathA)
+
+		if _, err := os.Stat(tempPath); err == nil {
+			var rerr error
+			action := "Completed"
+			if state.Attachments > 0 {
+				rerr = d.finishSwap(collection, marker, &state)
+			} else if _, serr := os.Stat(pathA); os.IsNotExist(serr) {
+				rerr = os.Rename(tempPath, pathA)
+				action = "Rolled back"
+			} else {
+				rerr = os.Rename(tempPath, pathB)
+			}
+			if rerr != nil {
+				return rerr
+			}
+			d.logger.Warn("%s interrupted swap of %s/%s and %s", action, collection, state.A, state.B)
+		}
+
+		if err := os.Remove(marker); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// finishSwap completes a Swap interrupted once its attachments had started
+// moving: the attachments are swapped, then B and A are put in place.
+func (d *Driver) finishSwap(collection, marker string, state *swapState) error {
+	if err := d.swapAttachments(collection, marker, state); err != nil {
+		return err
+	}
+
+	pathA := d.recordLocation(collection, state.A)
+	pathB := d.recordLocation(collection, state.B)
+	if _, err := os.Stat(pathA); os.IsNotExist(err) {
+		if err := os.Rename(pathB, pathA); err != nil {
+			return err
+		}
+	}
+	return os.Rename(swapTempPath(pathA), pathB)
+}
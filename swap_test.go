@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func putAttachment(t *testing.T, db *Driver, collection, resource, name, content string) {
+	t.Helper()
+	if err := db.PutAttachment(collection, resource, name, strings.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// attachmentContents maps each attachment of a record to its content.
+func attachmentContents(t *testing.T, db *Driver, collection, resource string) map[string]string {
+	t.Helper()
+	infos, err := db.ListAttachments(collection, resource)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents := make(map[string]string)
+	for _, info := range infos {
+		r, _, err := db.GetAttachment(collection, resource, info.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents[info.Name] = string(b)
+	}
+	return contents
+}
+
+func expectAttachments(t *testing.T, db *Driver, collection, resource string, want map[string]string) {
+	t.Helper()
+	got := attachmentContents(t, db, collection, resource)
+	if len(got) != len(want) {
+		t.Fatalf("%s attachments = %v, want %v", resource, got, want)
+	}
+	for name, content := range want {
+		if got[name] != content {
+			t.Fatalf("%s attachments = %v, want %v", resource, got, want)
+		}
+	}
+}
+
+func expectName(t *testing.T, db *Driver, resource, want string) {
+	t.Helper()
+	var user User
+	if err := db.Read("users", resource, &user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Name != want {
+		t.Fatalf("%s holds %q, want %q", resource, user.Name, want)
+	}
+}
+
+func TestSwapMovesAttachments(t *testing.T) {
+	db := newTestDriver(t, nil)
+	db.Write("users", "a", User{Name: "alice"})
+	db.Write("users", "b", User{Name: "bob"})
+	putAttachment(t, db, "users", "a", "avatar.png", "alice's avatar")
+	putAttachment(t, db, "users", "b", "cv.pdf", "bob's cv")
+
+	if err := db.Swap("users", "a", "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	expectName(t, db, "a", "bob")
+	expectName(t, db, "b", "alice")
+	expectAttachments(t, db, "users", "a", map[string]string{"cv.pdf": "bob's cv"})
+	expectAttachments(t, db, "users", "b", map[string]string{"avatar.png": "alice's avatar"})
+}
+
+func TestSwapMovesAttachmentsOfOneRecord(t *testing.T) {
+	db := newTestDriver(t, nil)
+	db.Write("users", "a", User{Name: "alice"})
+	db.Write("users", "b", User{Name: "bob"})
+	putAttachment(t, db, "users", "b", "cv.pdf", "bob's cv")
+
+	if err := db.Swap("users", "a", "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	expectAttachments(t, db, "users", "a", map[string]string{"cv.pdf": "bob's cv"})
+	expectAttachments(t, db, "users", "b", nil)
+}
+
+func TestSwapRecoversInterruptedAttachmentMove(t *testing.T) {
+	dir := t.TempDir()
+	db, err := New(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Write("users", "a", User{Name: "alice"})
+	db.Write("users", "b", User{Name: "bob"})
+	putAttachment(t, db, "users", "a", "avatar.png", "alice's avatar")
+	putAttachment(t, db, "users", "b", "cv.pdf", "bob's cv")
+	db.Close()
+
+	// Stop the swap as a crash would, after A was moved aside and A's
+	// attachments too, with the marker pointing at the next rename.
+	pathA := filepath.Join(dir, "users", "a.json")
+	attA := filepath.Join(dir, "users", attachmentsDir, "a")
+	if err := os.Rename(pathA, swapTempPath(pathA)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(attA, swapTempPath(attA)); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(swapState{A: "a", B: "b", Attachments: 2})
+	if err := ioutil.WriteFile(filepath.Join(dir, "users", swapMarker), b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = New(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	expectName(t, db, "a", "bob")
+	expectName(t, db, "b", "alice")
+	expectAttachments(t, db, "users", "a", map[string]string{"cv.pdf": "bob's cv"})
+	expectAttachments(t, db, "users", "b", map[string]string{"avatar.png": "alice's avatar"})
+	if _, err := os.Stat(filepath.Join(dir, "users", swapMarker)); !os.IsNotExist(err) {
+		t.Fatalf("swap marker left behind: %v", err)
+	}
+}
+
+func TestPromoteCopiesAttachments(t *testing.T) {
+	db := newTestDriver(t, nil)
+	db.Write("users", "draft", User{Name: "alice"})
+	db.Write("users", "live", User{Name: "bob"})
+	putAttachment(t, db, "users", "draft", "avatar.png", "new avatar")
+	putAttachment(t, db, "users", "live", "stale.txt", "old")
+
+	if err := db.Promote("users", "draft", "live"); err != nil {
+		t.Fatal(err)
+	}
+
+	expectName(t, db, "live", "alice")
+	expectAttachments(t, db, "users", "live", map[string]string{"avatar.png": "new avatar"})
+	expectAttachments(t, db, "users", "draft", map[string]string{"avatar.png": "new avatar"})
+}
+
+func TestPromoteWithoutAttachmentsClearsDestination(t *testing.T) {
+	db := newTestDriver(t, nil)
+	db.Write("users", "draft", User{Name: "alice"})
+	db.Write("users", "live", User{Name: "bob"})
+	putAttachment(t, db, "users", "live", "stale.txt", "old")
+
+	if err := db.Promote("users", "draft", "live"); err != nil {
+		t.Fatal(err)
+	}
+
+	expectAttachments(t, db, "users", "live", nil)
+}
+
+// interruptSwap leaves a Swap of a and b as a crash would, with A moved
+// aside and, if movedB, B already in A's place.
+func interruptSwap(t *testing.T, dir string, movedB bool) {
+	t.Helper()
+	db, err := New(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Write("users", "a", User{Name: "alice"})
+	db.Write("users", "b", User{Name: "bob"})
+	db.Close()
+
+	pathA := filepath.Join(dir, "users", "a.json")
+	pathB := filepath.Join(dir, "users", "b.json")
+	b, _ := json.Marshal(swapState{A: "a", B: "b"})
+	if err := ioutil.WriteFile(filepath.Join(dir, "users", swapMarker), b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(pathA, swapTempPath(pathA)); err != nil {
+		t.Fatal(err)
+	}
+	if movedB {
+		if err := os.Rename(pathB, pathA); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSwapRollsBackInterruptedSwap(t *testing.T) {
+	dir := t.TempDir()
+	interruptSwap(t, dir, false)
+
+	db, err := New(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	expectName(t, db, "a", "alice")
+	expectName(t, db, "b", "bob")
+	if _, err := os.Stat(filepath.Join(dir, "users", swapMarker)); !os.IsNotExist(err) {
+		t.Fatalf("swap marker left behind: %v", err)
+	}
+}
+
+func TestSwapCompletesInterruptedSwap(t *testing.T) {
+	dir := t.TempDir()
+	interruptSwap(t, dir, true)
+
+	db, err := New(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	expectName(t, db, "a", "bob")
+	expectName(t, db, "b", "alice")
+	if _, err := os.Stat(filepath.Join(dir, "users", swapMarker)); !os.IsNotExist(err) {
+		t.Fatalf("swap marker left behind: %v", err)
+	}
+}
+
+func TestSwapRecoveryKeepsMarkerOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	interruptSwap(t, dir, true)
+
+	// B's place is now a non-empty directory, so the roll-forward rename
+	// fails and the marker must survive for the next attempt.
+	pathB := filepath.Join(dir, "users", "b.json")
+	if err := os.MkdirAll(filepath.Join(pathB, "blocker"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := New(dir, nil); err == nil {
+		t.Fatal("expected recovery to fail")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "users", swapMarker)); err != nil {
+		t.Fatalf("swap marker removed after failed recovery: %v", err)
+	}
+	if _, err := os.Stat(swapTempPath(filepath.Join(dir, "users", "a.json"))); err != nil {
+		t.Fatalf("swapped-out record lost: %v", err)
+	}
+}
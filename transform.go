@@ -0,0 +1,45 @@
+package main
+
+import "encoding/json"
+
+// transform is a pair of hooks registered with SetTransform.
+type transform struct {
+	enc func(v interface{}) (interface{}, error)
+	dec func(raw json.RawMessage, v interface{}) error
+}
+
+// SetTransform installs hooks that reshape the records of a collection
+// between their Go values and their stored form, e.g. to store time.Time
+// fields as Unix milliseconds. Write and Append pass the value through enc
+// before marshaling it; computed fields, casing, and key, required field
+// and schema checks then apply to the result, so they validate the stored
+// form. Read decodes with dec, after field aliases and casing, in place of
+// json.Unmarshal. Either hook may be nil, and passing both nil removes the
+// transform. ReadAll and other raw reads return the stored form.
+func (d *Driver) SetTransform(collection string, enc func(v interface{}) (interface{}, error), dec func(raw json.RawMessage, v interface{}) error) {
+	collection, _, _ = d.transformKeys(collection, "")
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if enc == nil && dec == nil {
+		delete(d.transforms, collection)
+		return
+	}
+	d.transforms[collection] = &transform{enc: enc, dec: dec}
+}
+
+func (d *Driver) getTransform(collection string) *transform {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.transforms[collection]
+}
+
+// encodeValue applies the collection's encode hook, if any, to v.
+func (d *Driver) encodeValue(collection string, v interface{}) (interface{}, error) {
+	if t := d.getTransform(collection); t != nil && t.enc != nil {
+		return t.enc(v)
+	}
+	return v, nil
+}
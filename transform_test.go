@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+type event struct {
+	Name string
+	At   time.Time
+}
+
+type storedEvent struct {
+	Name string
+	AtMs int64
+}
+
+// setMillisTransform stores event.At as Unix milliseconds.
+func setMillisTransform(db *Driver, collection string) {
+	db.SetTransform(collection, func(v interface{}) (interface{}, error) {
+		e, ok := v.(event)
+		if !ok {
+			return nil, errors.New("not an event")
+		}
+		return storedEvent{e.Name, e.At.UnixMilli()}, nil
+	}, func(raw json.RawMessage, v interface{}) error {
+		var s storedEvent
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return err
+		}
+		*v.(*event) = event{s.Name, time.UnixMilli(s.AtMs)}
+		return nil
+	})
+}
+
+func TestSetTransformRoundTrip(t *testing.T) {
+	db := newTestDriver(t, nil)
+	setMillisTransform(db, "events")
+
+	at := time.UnixMilli(1700000000123)
+	if err := db.Write("events", "launch", event{"launch", at}); err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := os.ReadFile(db.recordPath("events", "launch"))
+	var stored map[string]interface{}
+	json.Unmarshal(b, &stored)
+	if stored["AtMs"] != float64(1700000000123) || stored["At"] != nil {
+		t.Fatalf("stored %s, want At as Unix milliseconds", b)
+	}
+
+	var got event
+	if err := db.Read("events", "launch", &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "launch" || !got.At.Equal(at) {
+		t.Fatalf("Read = %+v, want %v", got, at)
+	}
+
+	if err := db.Write("events", "bad", "not an event"); err == nil {
+		t.Fatal("Write with a failing encode hook succeeded")
+	}
+}
+
+func TestSetTransformValidatesStoredForm(t *testing.T) {
+	db := newTestDriver(t, &Options{KeyFields: map[string]string{"events": "Name"}})
+	setMillisTransform(db, "events")
+	e := event{"launch", time.Now()}
+
+	if err := db.SetRequiredFields("events", []string{"AtMs"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Write("events", "launch", e); err != nil {
+		t.Fatalf("Write with a field only the stored form has required = %v", err)
+	}
+
+	if err := db.SetRequiredFields("events", []string{"At"}); err != nil {
+		t.Fatal(err)
+	}
+	var missing ErrMissingField
+	if err := db.Write("events", "launch", e); !errors.As(err, &missing) {
+		t.Fatalf("Write with a field only the Go value has required = %v, want ErrMissingField", err)
+	}
+}
+
+func TestSetTransformRemove(t *testing.T) {
+	db := newTestDriver(t, nil)
+	setMillisTransform(db, "events")
+	db.SetTransform("events", nil, nil)
+
+	if err := db.Write("events", "raw", map[string]string{"Name": "raw"}); err != nil {
+		t.Fatalf("Write after removing the transform = %v", err)
+	}
+	if db.getTransform("events") != nil {
+		t.Fatal("transform left after SetTransform(nil, nil)")
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// checkKeyField verifies that the configured key field of a marshaled record
+// matches the resource it is being written under, once both are passed
+// through Options.KeyTransformer.
+func (d *Driver) checkKeyField(collection, resource string, b []byte) error {
+	field, ok := d.keyFields[collection]
+	if !ok {
+		if d.keyField == "" {
+			return nil
+		}
+		field = d.keyField
+	}
+
+	var doc map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return fmt.Errorf("Key field %s- record in %s is not an object", field, collection)
+	}
+
+	value, ok := doc[field]
+	if !ok || value == nil {
+		return fmt.Errorf("Key field %s- missing from record %s/%s", field, collection, resource)
+	}
+
+	key := fmt.Sprint(value)
+	if _, transformed, err := d.transformKeys("", key); err != nil || transformed != resource {
+		return fmt.Errorf("Key field %s- record has %q but resource is %q", field, key, resource)
+	}
+	return nil
+}
+
+// SetRequiredFields makes Write reject records of a collection that lack any
+// of the given top-level fields or have them set to null. The list is kept
+// in the collection directory as _required.json; an empty list removes it.
+func (d *Driver) SetRequiredFields(collection string, fields []string) error {
+	collection, _, err := d.transformKeys(collection, "")
+	if err != nil {
+		return err
+	}
+
+	if collection == "" {
+		return ErrMissingCollection
+	}
+
+	mutex, err := d.lockCollection(collection)
+	if err != nil {
+		return err
+	}
+	defer mutex.Unlock()
+
+	path := d.requiredPath(collection)
+	if len(fields) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	} else {
+		b, err := json.MarshalIndent(fields, "", "\t")
+		if err != nil {
+			return err
+		}
+		if err := d.writeFile(path, append(b, byte('\n'))); err != nil {
+			return err
+		}
+	}
+
+	d.mutex.Lock()
+	d.required[collection] = append([]string{}, fields...)
+	d.mutex.Unlock()
+	return nil
+}
+
+// checkRequired enforces SetRequiredFields on a marshaled record.
+func (d *Driver) checkRequired(collection string, b []byte) error {
+	fields, err := d.requiredFields(collection)
+	if err != nil || len(fields) == 0 {
+		return err
+	}
+
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return fmt.Errorf("Required fields- records in %s must be objects", collection)
+	}
+
+	for _, field := range fields {
+		if value, ok := doc[field]; !ok || jsonType(value) == "null" {
+			return ErrMissingField{Field: field}
+		}
+	}
+	return nil
+}
+
+// requiredFields returns the cached required fields of a collection,
+// reading _required.json the first time.
+func (d *Driver) requiredFields(collection string) ([]string, error) {
+	d.mutex.Lock()
+	fields, ok := d.required[collection]
+	d.mutex.Unlock()
+	if ok {
+		return fields, nil
+	}
+
+	var stored []string
+	b, err := d.readFile(d.requiredPath(collection))
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(b, &stored); err != nil {
+			return nil, fmt.Errorf("Corrupt required fields- %s: %v", collection, err)
+		}
+	}
+
+	d.mutex.Lock()
+	d.required[collection] = stored
+	d.mutex.Unlock()
+	return stored, nil
+}
+
+func (d *Driver) requiredPath(collection string) string {
+	return filepath.Join(d.dir, collection, "_required.json")
+}
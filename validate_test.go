@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDeleteCollectionForgetsRequiredFields(t *testing.T) {
+	db := newTestDriver(t, nil)
+	if err := db.SetRequiredFields("users", []string{"Email"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var missing ErrMissingField
+	if err := db.Write("users", "john", benchUser); !errors.As(err, &missing) {
+		t.Fatalf("Write without Email = %v, want ErrMissingField", err)
+	}
+
+	db.Write("users", "jane", map[string]string{"Email": "jane@example.com"})
+	if err := db.Delete("users", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Write("users", "john", benchUser); err != nil {
+		t.Fatalf("Write to recreated collection = %v, want the old required fields gone", err)
+	}
+}
+
+func TestDeleteRejectsReservedResources(t *testing.T) {
+	db := newTestDriver(t, nil)
+	if err := db.SetRequiredFields("users", []string{"Name"}); err != nil {
+		t.Fatal(err)
+	}
+	db.SetCollectionReadOnly("users", false)
+
+	for resource := range reservedResources {
+		if err := db.Delete("users", resource); err == nil {
+			t.Errorf("Delete(users, %s) succeeded", resource)
+		}
+	}
+
+	if err := db.Write("users", "noname", map[string]int{"Age": 1}); err == nil {
+		t.Fatal("required fields lost after rejected Delete")
+	}
+}
+
+func TestKeyFieldRejectsMismatch(t *testing.T) {
+	db := newTestDriver(t, &Options{KeyFields: map[string]string{"users": "Name"}})
+
+	jane := benchUser
+	jane.Name = "jane"
+	if err := db.Write("users", "john", jane); err == nil {
+		t.Fatal("Write of jane under john succeeded")
+	}
+	if _, err := os.Stat(db.recordPath("users", "john")); !os.IsNotExist(err) {
+		t.Fatalf("rejected record was stored: %v", err)
+	}
+
+	if err := db.Write("users", "jane", jane); err != nil {
+		t.Fatalf("Write of jane under jane = %v", err)
+	}
+}
+
+func TestKeyFieldOff(t *testing.T) {
+	db := newTestDriver(t, nil)
+
+	jane := benchUser
+	jane.Name = "jane"
+	if err := db.Write("users", "john", jane); err != nil {
+		t.Fatalf("Write without KeyFields = %v", err)
+	}
+}
+
+func TestKeyFieldDefault(t *testing.T) {
+	db := newTestDriver(t, &Options{KeyField: "id", KeyFields: map[string]string{"users": "Name"}})
+
+	for _, tc := range []struct {
+		collection, resource string
+		v                    interface{}
+		ok                   bool
+	}{
+		{"things", "a", map[string]string{"id": "a"}, true},
+		{"things", "a", map[string]string{"id": "b"}, false},
+		{"things", "a", map[string]string{"name": "a"}, false},
+		{"things", "a", []int{1}, false},
+		{"users", "john", benchUser, true},
+	} {
+		err := db.Write(tc.collection, tc.resource, tc.v)
+		if (err == nil) != tc.ok {
+			t.Errorf("Write(%s, %s, %v) = %v, want ok %v", tc.collection, tc.resource, tc.v, err, tc.ok)
+		}
+	}
+}
+
+func TestKeyFieldWithKeyTransformer(t *testing.T) {
+	db := newTestDriver(t, &Options{KeyField: "ID", KeyTransformer: strings.ToLower})
+
+	for _, tc := range []struct {
+		resource, id string
+		ok           bool
+	}{
+		{"John", "John", true},
+		{"John", "john", true},
+		{"john", "JOHN", true},
+		{"John", "Jane", false},
+	} {
+		err := db.Write("users", tc.resource, map[string]string{"ID": tc.id})
+		if (err == nil) != tc.ok {
+			t.Errorf("Write(users, %s) with ID %s = %v, want ok %v", tc.resource, tc.id, err, tc.ok)
+		}
+	}
+
+	var got map[string]string
+	if err := db.Read("users", "JOHN", &got); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeyFieldRejectsArraysAndMissingID(t *testing.T) {
+	db := newTestDriver(t, &Options{KeyField: "id"})
+
+	for resource, v := range map[string]interface{}{
+		"array":   []string{"a"},
+		"scalar":  42,
+		"missing": map[string]string{"name": "missing"},
+		"null":    map[string]interface{}{"id": nil},
+	} {
+		err := db.Write("things", resource, v)
+		if err == nil || !strings.Contains(err.Error(), "Key field id") {
+			t.Errorf("Write(%s) = %v, want a key field error", resource, err)
+		}
+		if _, err := os.Stat(db.recordPath("things", resource)); !os.IsNotExist(err) {
+			t.Errorf("rejected %s record was stored", resource)
+		}
+	}
+
+	if err := db.Write("things", "7", map[string]int{"id": 7}); err != nil {
+		t.Fatalf("Write with a numeric id matching the resource = %v", err)
+	}
+}
+
+func TestKeyFieldSkipsGeneratedKeys(t *testing.T) {
+	db := newTestDriver(t, &Options{KeyField: "id"})
+
+	if _, err := db.Append("log", map[string]string{"msg": "started"}); err != nil {
+		t.Fatalf("Append = %v", err)
+	}
+	if _, err := db.InsertContentAddressed("blobs", map[string]string{"msg": "hi"}); err != nil {
+		t.Fatalf("InsertContentAddressed = %v", err)
+	}
+}
+
+func TestRequiredFields(t *testing.T) {
+	dir := t.TempDir()
+	db, err := New(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetRequiredFields("users", []string{"Name", "Email"}); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// The list is stored with the collection.
+	db, err = New(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for name, record := range map[string]map[string]interface{}{
+		"absent": {"Name": "john"},
+		"null":   {"Name": "john", "Email": nil},
+	} {
+		err := db.Write("users", "john", record)
+		if !errors.Is(err, ErrMissingField{}) || !errors.Is(err, ErrMissingField{Field: "Email"}) {
+			t.Errorf("Write with Email %s = %v, want ErrMissingField for Email", name, err)
+		}
+		if errors.Is(err, ErrMissingField{Field: "Name"}) {
+			t.Errorf("Write with Email %s reported Name missing", name)
+		}
+	}
+	if _, err := os.Stat(db.recordPath("users", "john")); !os.IsNotExist(err) {
+		t.Fatalf("rejected record was stored: %v", err)
+	}
+
+	if err := db.Write("users", "john", map[string]string{"Name": "john", "Email": "john@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.SetRequiredFields("users", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Write("users", "jane", map[string]string{"Name": "jane"}); err != nil {
+		t.Fatalf("Write after clearing required fields = %v", err)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"sync"
+)
+
+// VectorIndex holds the embedding vectors of a collection in memory for
+// similarity search. It is kept up to date by writes and deletes made
+// through the driver.
+//
+// KNN is an exact linear scan, which is fine for tens of thousands of
+// vectors. An approximate graph index such as HNSW could later sit behind
+// the same methods for larger collections.
+type VectorIndex struct {
+	d          *Driver
+	collection string
+	field      string
+	dims       int
+
+	mutex   sync.RWMutex
+	vectors map[string][]float64
+}
+
+// CreateVectorIndex indexes the array of dims numbers at field, a dotted
+// path as in GroupBy, of every record in a collection. Records without such
+// an array, or with a zero vector, are left out.
+func (d *Driver) CreateVectorIndex(collection, field string, dims int) (*VectorIndex, error) {
+	collection, _, err := d.transformKeys(collection, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if collection == "" {
+		return nil, ErrMissingCollection
+	}
+
+	if dims <= 0 {
+		return nil, fmt.Errorf("Invalid dimensions- %d", dims)
+	}
+
+	idx := &VectorIndex{d: d, collection: collection, field: field, dims: dims}
+	// Writes wait on the collection mutex until the index is registered,
+	// so none lands between the scan and addIndex unindexed.
+	mutex, err := d.lockForRead(collection)
+	if err != nil {
+		return nil, err
+	}
+	defer mutex.Unlock()
+
+	if err := idx.rebuild(); err != nil {
+		return nil, err
+	}
+
+	d.addIndex(collection, idx)
+	return idx, nil
+}
+
+// KNN returns up to k resources whose vectors have the highest cosine
+// similarity to query, most similar first.
+func (idx *VectorIndex) KNN(query []float64, k int) ([]string, error) {
+	if len(query) != idx.dims {
+		return nil, fmt.Errorf("Invalid query- %d dimensions, index has %d", len(query), idx.dims)
+	}
+
+	unit, ok := normalize(query)
+	if !ok {
+		return nil, fmt.Errorf("Invalid query- zero vector")
+	}
+
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+
+	if k <= 0 {
+		return nil, nil
+	}
+
+	type match struct {
+		resource   string
+		similarity float64
+	}
+
+	matches := make([]match, 0, len(idx.vectors))
+	for resource, vector := range idx.vectors {
+		var dot float64
+		for i, x := range vector {
+			dot += x * unit[i]
+		}
+		matches = append(matches, match{resource, dot})
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].similarity != matches[j].similarity {
+			return matches[i].similarity > matches[j].similarity
+		}
+		return matches[i].resource < matches[j].resource
+	})
+
+	if len(matches) > k {
+		matches = matches[:k]
+	}
+
+	resources := make([]string, len(matches))
+	for i, m := range matches {
+		resources[i] = m.resource
+	}
+	return resources, nil
+}
+
+// Rebuild reindexes every record of the collection from disk, e.g. after
+// records were changed by another process.
+func (idx *VectorIndex) Rebuild() error {
+	mutex, err := idx.d.lockCollection(idx.collection)
+	if err != nil {
+		return err
+	}
+	defer mutex.Unlock()
+
+	return idx.rebuild()
+}
+
+func (idx *VectorIndex) rebuild() error {
+	vectors := make(map[string][]float64)
+	err := idx.d.forEachFile(idx.collection, func(resource string, b []byte) error {
+		if vector, ok := idx.vector(b); ok {
+			vectors[resource] = vector
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	idx.mutex.Lock()
+	idx.vectors = vectors
+	idx.mutex.Unlock()
+	return nil
+}
+
+func (idx *VectorIndex) update(resource string, b []byte) {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+
+	delete(idx.vectors, resource)
+	if b == nil {
+		return
+	}
+	if vector, ok := idx.vector(b); ok {
+		idx.vectors[resource] = vector
+	}
+}
+
+// vector reads a record's vector, scaled to unit length so that cosine
+// similarity is a dot product.
+func (idx *VectorIndex) vector(b []byte) ([]float64, bool) {
+	doc, err := idx.d.indexDocument(idx.collection, b)
+	if err != nil {
+		return nil, false
+	}
+
+	value, _ := lookupField(doc, idx.field)
+	elems, ok := value.([]interface{})
+	if !ok || len(elems) != idx.dims {
+		return nil, false
+	}
+
+	vector := make([]float64, idx.dims)
+	for i, elem := range elems {
+		n, ok := elem.(json.Number)
+		if !ok {
+			return nil, false
+		}
+		if vector[i], err = n.Float64(); err != nil {
+			return nil, false
+		}
+	}
+	return normalize(vector)
+}
+
+// normalize returns v scaled to unit length, or false for a zero vector.
+func normalize(v []float64) ([]float64, bool) {
+	var sum float64
+	for _, x := range v {
+		sum += x * x
+	}
+
+	norm := math.Sqrt(sum)
+	if norm == 0 || math.IsInf(norm, 0) || math.IsNaN(norm) {
+		return nil, false
+	}
+
+	unit := make([]float64, len(v))
+	for i, x := range v {
+		unit[i] = x / norm
+	}
+	return unit, true
+}
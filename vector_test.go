@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestKNNMatchesBruteForce(t *testing.T) {
+	db := newTestDriver(t, nil)
+	rng := rand.New(rand.NewSource(1))
+	vectors := make(map[string][]float64)
+	for i := 0; i < 100; i++ {
+		v := []float64{rng.NormFloat64(), rng.NormFloat64(), rng.NormFloat64()}
+		resource := fmt.Sprintf("r%03d", i)
+		vectors[resource] = v
+		db.Write("docs", resource, map[string]interface{}{"v": v})
+	}
+	// Neither a missing nor a wrong-sized vector is indexed.
+	db.Write("docs", "none", map[string]interface{}{"title": "x"})
+	db.Write("docs", "short", map[string]interface{}{"v": []float64{1, 2}})
+
+	idx, err := db.CreateVectorIndex("docs", "v", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := []float64{0.3, -1, 2}
+	resources := make([]string, 0, len(vectors))
+	for resource := range vectors {
+		resources = append(resources, resource)
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		return cosine(query, vectors[resources[i]]) > cosine(query, vectors[resources[j]])
+	})
+
+	for _, k := range []int{1, 5, 100, 500} {
+		got, err := idx.KNN(query, k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := resources
+		if k < len(want) {
+			want = want[:k]
+		}
+		if len(got) != len(want) {
+			t.Fatalf("KNN(k=%d) = %d results, want %d", k, len(got), len(want))
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("KNN(k=%d)[%d] = %s, want %s", k, i, got[i], want[i])
+			}
+		}
+	}
+
+	if got, err := idx.KNN(query, 0); err != nil || len(got) != 0 {
+		t.Fatalf("KNN(k=0) = %v, %v", got, err)
+	}
+}
+
+func cosine(a, b []float64) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+func TestKNNRejectsBadQueries(t *testing.T) {
+	db := newTestDriver(t, nil)
+	db.Write("docs", "a", map[string]interface{}{"v": []float64{1, 0}})
+	idx, err := db.CreateVectorIndex("docs", "v", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := idx.KNN([]float64{1, 0, 0}, 1); err == nil {
+		t.Error("KNN accepted a query of the wrong dimension")
+	}
+	if _, err := idx.KNN([]float64{0, 0}, 1); err == nil {
+		t.Error("KNN accepted a zero vector")
+	}
+	if _, err := db.CreateVectorIndex("docs", "v", 0); err == nil {
+		t.Error("CreateVectorIndex accepted zero dimensions")
+	}
+}
+
+func TestKNNFollowsWrites(t *testing.T) {
+	db := newTestDriver(t, nil)
+	db.Write("docs", "a", map[string]interface{}{"v": []float64{1, 0}})
+	idx, err := db.CreateVectorIndex("docs", "v", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db.Write("docs", "b", map[string]interface{}{"v": []float64{0, 1}})
+	if got, _ := idx.KNN([]float64{0, 1}, 1); len(got) != 1 || got[0] != "b" {
+		t.Fatalf("KNN after write = %v, want [b]", got)
+	}
+
+	db.Delete("docs", "b")
+	if got, _ := idx.KNN([]float64{0, 1}, 1); len(got) != 1 || got[0] != "a" {
+		t.Fatalf("KNN after delete = %v, want [a]", got)
+	}
+}
+
+func TestCreateVectorIndexDuringWrites(t *testing.T) {
+	db := newTestDriver(t, nil)
+	for i := 0; i < 50; i++ {
+		db.Write("docs", fmt.Sprintf("d%03d", i), map[string]interface{}{"v": []float64{1, 1}})
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 50; i < 200; i++ {
+			db.Write("docs", fmt.Sprintf("d%03d", i), map[string]interface{}{"v": []float64{1, 2}})
+		}
+	}()
+
+	idx, err := db.CreateVectorIndex("docs", "v", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+
+	if got, _ := idx.KNN([]float64{1, 1}, 1000); len(got) != 200 {
+		t.Fatalf("KNN found %d records, want all 200", len(got))
+	}
+}